@@ -0,0 +1,321 @@
+package trana
+
+import (
+	"context"
+	"html"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/esote/trana/internal/anki"
+)
+
+// AnkiPackage is an Anki .apkg package opened for import.
+type AnkiPackage struct {
+	pkg *anki.Package
+}
+
+// AnkiModel is an Anki note type, listing the fields of its notes.
+type AnkiModel struct {
+	ID     int64
+	Name   string
+	Fields []string
+}
+
+// AnkiMapping chooses the note fields, by index, which become the front and
+// back of cards.
+type AnkiMapping struct {
+	Front int
+	Back  int
+}
+
+var DefaultAnkiMapping = AnkiMapping{Front: 0, Back: 1}
+
+// ankiNamespace is the namespace of UUIDs derived from Anki note GUIDs.
+const ankiNamespace = "3f1f6c1e-8d6b-4a52-9a57-2f7c1b0e6d41"
+
+// ankiUUID returns the UUID of a card imported from an Anki note. Notes
+// exported by Träna have the UUID of their card as GUID, other GUIDs are
+// turned into a UUID so that importing the note again finds the same card.
+func ankiUUID(guid string) string {
+	if guid == "" {
+		return ""
+	}
+	if uuid := cleanUUID(guid); uuid != "" {
+		return uuid
+	}
+	return nameUUID(ankiNamespace, guid)
+}
+
+func OpenAnki(r io.ReaderAt, size int64) (*AnkiPackage, error) {
+	pkg, err := anki.Read(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return &AnkiPackage{pkg}, nil
+}
+
+func (p *AnkiPackage) Models() []AnkiModel {
+	var models []AnkiModel
+	for _, m := range p.pkg.Models {
+		models = append(models, AnkiModel{
+			ID:     m.ID,
+			Name:   m.Name,
+			Fields: m.Fields,
+		})
+	}
+	return models
+}
+
+// ImportAnki imports the notes of an Anki package as cards like ImportCards,
+// converting their review intervals to comfort, and copies its media files once
+// the cards are imported. The fields of notes are mapped by the mapping of
+// their model in mappings, keyed by AnkiModel.ID, or by DefaultAnkiMapping.
+// Notes with an empty front or back, or without the mapped fields, are skipped.
+func (t *Trana) ImportAnki(ctx context.Context, deck int64, p *AnkiPackage, mappings map[int64]AnkiMapping, opts *ImportOptions) (*ImportReport, error) {
+	var cards []Card
+	skipped := 0
+	for _, note := range p.pkg.Notes {
+		m, ok := mappings[note.Model]
+		if !ok {
+			m = DefaultAnkiMapping
+		}
+		if m.Front < 0 || m.Front >= len(note.Fields) || m.Back < 0 || m.Back >= len(note.Fields) {
+			skipped++
+			continue
+		}
+		card := Card{
+			UUID:    ankiUUID(note.GUID),
+			Front:   ankiText(note.Fields[m.Front]),
+			Back:    ankiText(note.Fields[m.Back]),
+			Tags:    note.Tags,
+			Comfort: -1,
+		}
+		if card.Front == "" || card.Back == "" {
+			skipped++
+			continue
+		}
+		if c, ok := p.pkg.Cards[note.ID]; ok {
+			card.Comfort = ankiComfort(&c)
+			card.LastPracticed = c.LastReview
+			card.Suspended = c.Suspended
+			if c.Buried {
+				// Anki buries cards until the next day
+				tomorrow := t.day(time.Now()).AddDate(0, 0, 1)
+				card.BuriedUntil = &tomorrow
+			}
+		}
+		cards = append(cards, card)
+	}
+
+	// Media is written aside first, so that a failed import leaves none of it
+	var staged string
+	if opts == nil || !opts.DryRun {
+		var err error
+		if staged, err = t.stageMedia(p.pkg.Media); err != nil {
+			return nil, err
+		}
+		if staged != "" {
+			defer os.RemoveAll(staged)
+		}
+	}
+
+	report, err := t.ImportCards(ctx, deck, cards, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.Skipped = skipped
+	if staged != "" {
+		if err = moveMedia(staged, t.mediaDir); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// stageMedia writes media files into a new hidden directory of the media
+// directory, returning it, or "" if there is nothing to write.
+func (t *Trana) stageMedia(media []anki.Media) (string, error) {
+	if t.mediaDir == "" || len(media) == 0 {
+		return "", nil
+	}
+	if err := os.MkdirAll(t.mediaDir, 0700); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(t.mediaDir, ".import-*")
+	if err != nil {
+		return "", err
+	}
+	for i := range media {
+		if err = writeMedia(dir, media[i].Name, media[i].Open); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// moveMedia moves the media files of a staging directory into dir, replacing
+// any files of the same names.
+func moveMedia(staged, dir string) error {
+	entries, err := os.ReadDir(staged)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if err = os.Rename(filepath.Join(staged, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMedia writes a media file into dir atomically, replacing any file of the
+// same name.
+func writeMedia(dir, name string, open func() (io.ReadCloser, error)) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp(dir, ".import-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, rc)
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, filepath.Base(name)))
+}
+
+var (
+	ankiImage = regexp.MustCompile(`(?i)<img[^>]*\ssrc="?([^">]+)"?[^>]*>`)
+	ankiBreak = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>|</li>`)
+	ankiTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ankiText converts the HTML of an Anki field to plain text. Images are kept
+// as [image:name] references, like Anki's [sound:name].
+func ankiText(s string) string {
+	s = ankiImage.ReplaceAllString(s, "[image:$1]")
+	s = ankiBreak.ReplaceAllString(s, " ")
+	s = ankiTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ankiConfident is the review interval in days at which a card is considered
+// confident.
+const ankiConfident = 21
+
+// ankiComfort maps the review interval of a card linearly onto the comfort of
+// reviews.
+func ankiComfort(c *anki.Card) float64 {
+	if c.Type == 0 {
+		return -1
+	}
+	days := math.Max(float64(c.Interval), 0)
+	return ComfortReviewMin + (ComfortReviewMax-ComfortReviewMin)*math.Min(days/ankiConfident, 1)
+}
+
+// ExportAnki writes a deck as an Anki package, converting comfort to review
+// intervals. Notes keep the tags of cards and are also tagged with the deck
+// name, and media files referenced by cards are included.
+func (t *Trana) ExportAnki(ctx context.Context, deck int64, w io.Writer) error {
+	d, err := t.GetDeck(ctx, deck)
+	if err != nil {
+		return err
+	}
+	cards, err := t.ListCards(ctx, deck)
+	if err != nil {
+		return err
+	}
+
+	pkg := anki.Package{
+		Cards: make(map[int64]anki.Card),
+	}
+	tag := strings.Join(strings.Fields(d.Name), "_")
+	media := make(map[string]bool)
+	for _, card := range cards {
+		note := anki.Note{
+			ID:     card.ID,
+			GUID:   card.UUID,
+			Fields: []string{ankiHTML(card.Front), ankiHTML(card.Back)},
+			Tags:   card.Tags,
+		}
+		if tag != "" {
+			note.Tags = strings.Fields(joinTags(append([]string{tag}, card.Tags...)))
+		}
+		pkg.Notes = append(pkg.Notes, note)
+
+		c := anki.Card{
+			Note:       card.ID,
+			LastReview: card.LastPracticed,
+			Suspended:  card.Suspended,
+			Buried:     card.Buried(),
+		}
+		if card.Comfort != -1 && card.LastPracticed != nil {
+			c.Type = 2
+			c.Interval = ankiInterval(card.Comfort)
+			c.Reps = 1
+		}
+		pkg.Cards[card.ID] = c
+
+		for _, s := range []string{card.Front, card.Back} {
+			for _, m := range ankiMedia.FindAllStringSubmatch(s, -1) {
+				media[filepath.Base(m[2])] = true
+			}
+		}
+	}
+
+	if t.mediaDir != "" {
+		for name := range media {
+			path := filepath.Join(t.mediaDir, name)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			pkg.Media = append(pkg.Media, anki.Media{
+				Name: name,
+				Open: func() (io.ReadCloser, error) {
+					return os.Open(path)
+				},
+			})
+		}
+	}
+
+	return anki.Write(w, d.Name, &pkg)
+}
+
+var ankiMedia = regexp.MustCompile(`\[(image|sound):([^\]]+)\]`)
+
+// ankiHTML is the inverse of ankiText, turning image references back into
+// HTML.
+func ankiHTML(s string) string {
+	s = html.EscapeString(s)
+	return ankiMedia.ReplaceAllStringFunc(s, func(ref string) string {
+		m := ankiMedia.FindStringSubmatch(ref)
+		if m[1] == "image" {
+			return `<img src="` + m[2] + `">`
+		}
+		return ref
+	})
+}
+
+// ankiInterval is the inverse of ankiComfort.
+func ankiInterval(comfort float64) int64 {
+	frac := (comfort - ComfortReviewMin) / (ComfortReviewMax - ComfortReviewMin)
+	return int64(math.Max(math.Round(frac*ankiConfident), 1))
+}
@@ -0,0 +1,565 @@
+package trana
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	backupFormat = "trana-backup"
+
+	// BackupVersion is the version of the backup archive format written by
+	// Backup. Restore reads this and older versions.
+	BackupVersion = 1
+)
+
+var (
+	ErrNotBackup     = errors.New("trana: not a backup archive")
+	ErrBackupVersion = errors.New("trana: backup is from a newer version of trana")
+)
+
+// backupManifest describes a backup archive. It is stored as manifest.json
+// next to decks.json, cards.json, reviews.json, deck_settings.json, the optional
+// settings.json and media files under media/. Archives of older versions may
+// lack deck_settings.json.
+type backupManifest struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Schema  uint      `json:"schema"`
+	Created time.Time `json:"created"`
+
+	Decks   int `json:"decks"`
+	Cards   int `json:"cards"`
+	Reviews int `json:"reviews"`
+	Media   int `json:"media"`
+
+	DeckSettings int `json:"deck_settings"`
+}
+
+// Backup writes the whole collection with its review history and media to w as
+// a zip archive. Settings, if not nil, are stored as they are and returned by
+// Restore.
+func (t *Trana) Backup(ctx context.Context, w io.Writer, settings json.RawMessage) error {
+	schema, err := t.db.Version()
+	if err != nil {
+		return err
+	}
+	manifest := backupManifest{
+		Format:  backupFormat,
+		Version: BackupVersion,
+		Schema:  schema,
+		Created: time.Now().UTC(),
+	}
+
+	var decks []Deck
+	var cards []Card
+	var reviews []Review
+	var deckSettings []DeckSettings
+	err = t.db.Tx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if deckSettings, err = listDeckSettings(tx); err != nil {
+			return err
+		}
+		if decks, err = backupDecks(tx); err != nil {
+			return err
+		}
+		if cards, err = backupCards(tx); err != nil {
+			return err
+		}
+		reviews, err = backupReviews(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	media, err := t.listMedia()
+	if err != nil {
+		return err
+	}
+
+	manifest.Decks = len(decks)
+	manifest.Cards = len(cards)
+	manifest.Reviews = len(reviews)
+	manifest.Media = len(media)
+	manifest.DeckSettings = len(deckSettings)
+
+	z := zip.NewWriter(w)
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"manifest.json", manifest},
+		{"decks.json", decks},
+		{"cards.json", cards},
+		{"reviews.json", reviews},
+		{"deck_settings.json", deckSettings},
+	}
+	if settings != nil {
+		files = append(files, struct {
+			name string
+			v    any
+		}{"settings.json", settings})
+	}
+	for _, f := range files {
+		fw, err := backupCreate(z, f.name, manifest.Created)
+		if err != nil {
+			return err
+		}
+		e := json.NewEncoder(fw)
+		e.SetIndent("", "\t")
+		if err = e.Encode(f.v); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range media {
+		if err = backupMedia(z, filepath.Join(t.mediaDir, name), name, manifest.Created); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func backupDecks(tx *sql.Tx) ([]Deck, error) {
+	rows, err := tx.Query(`SELECT ` + deckColumns + `
+		FROM "decks"
+		WHERE "deleted" IS NULL
+		ORDER BY "id" ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	decks := []Deck{}
+	for rows.Next() {
+		var deck Deck
+		if err = scanDeck(rows, &deck); err != nil {
+			return nil, err
+		}
+		decks = append(decks, deck)
+	}
+	return decks, rows.Err()
+}
+
+func backupCards(tx *sql.Tx) ([]Card, error) {
+	rows, err := tx.Query(`SELECT ` + cardColumns + `
+		FROM "cards"
+		WHERE ` + liveCards + `
+		ORDER BY "id" ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cards := []Card{}
+	for rows.Next() {
+		var card Card
+		if err = scanCard(rows, &card); err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, rows.Err()
+}
+
+func backupReviews(tx *sql.Tx) ([]Review, error) {
+	rows, err := tx.Query(`SELECT "reviews"."id", "card", "time", "reviews"."comfort", "correct", "duration"
+		FROM "reviews"
+		JOIN "cards" ON "cards"."id" = "reviews"."card"
+		WHERE ` + liveCards + `
+		ORDER BY "reviews"."id" ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reviews := []Review{}
+	for rows.Next() {
+		var review Review
+		var unix int64
+		var correct sql.NullBool
+		var duration sql.NullInt64
+		if err = rows.Scan(&review.ID, &review.Card, &unix, &review.Comfort, &correct, &duration); err != nil {
+			return nil, err
+		}
+		review.Time = time.Unix(unix, 0)
+		if correct.Valid {
+			review.Correct = &correct.Bool
+		}
+		review.Duration = time.Duration(duration.Int64) * time.Millisecond
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// listMedia returns the names of the files in the media directory.
+func (t *Trana) listMedia() ([]string, error) {
+	if t.mediaDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(t.mediaDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		// Skip unfinished writes of writeMedia
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+func backupCreate(z *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return z.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+}
+
+func backupMedia(z *zip.Writer, file, name string, modified time.Time) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := backupCreate(z, "media/"+name, modified)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+type RestoreOptions struct {
+	// Merge restores decks into existing decks of the same name, updating
+	// cards already in them like Import. Otherwise every deck is restored as
+	// a new deck.
+	Merge bool
+}
+
+type RestoreResult struct {
+	Decks   int
+	Cards   int
+	Reviews int
+	Media   int
+
+	// Settings stored by Backup, nil if none
+	Settings json.RawMessage
+}
+
+// Restore reads a backup archive into the collection. Decks, cards, reviews and
+// deck settings get new IDs, references between them are remapped. Deck
+// settings are reused if the collection has the same settings of the same
+// name, and restored under a new name if the name is taken by others.
+func (t *Trana) Restore(ctx context.Context, r io.ReaderAt, size int64, opts *RestoreOptions) (*RestoreResult, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotBackup
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	var manifest backupManifest
+	if err = readBackupFile(files, "manifest.json", &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Format != backupFormat {
+		return nil, ErrNotBackup
+	}
+	schema, err := t.db.Version()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version > BackupVersion || manifest.Schema > schema {
+		return nil, ErrBackupVersion
+	}
+
+	var decks []Deck
+	var cards []Card
+	var reviews []Review
+	var deckSettings []DeckSettings
+	if files["deck_settings.json"] != nil {
+		if err = readBackupFile(files, "deck_settings.json", &deckSettings); err != nil {
+			return nil, err
+		}
+	}
+	if err = readBackupFile(files, "decks.json", &decks); err != nil {
+		return nil, err
+	}
+	if err = readBackupFile(files, "cards.json", &cards); err != nil {
+		return nil, err
+	}
+	if err = readBackupFile(files, "reviews.json", &reviews); err != nil {
+		return nil, err
+	}
+
+	result := RestoreResult{
+		Decks:   len(decks),
+		Cards:   len(cards),
+		Reviews: len(reviews),
+	}
+	if files["settings.json"] != nil {
+		if err = readBackupFile(files, "settings.json", &result.Settings); err != nil {
+			return nil, err
+		}
+	}
+
+	err = t.db.Tx(ctx, func(tx *sql.Tx) error {
+		stmts, err := prepareImport(tx)
+		if err != nil {
+			return err
+		}
+		defer stmts.Close()
+		deckUUIDs, err := tx.Prepare(uuidUsedQuery("decks"))
+		if err != nil {
+			return err
+		}
+		defer deckUUIDs.Close()
+
+		settingsIDs := make(map[int64]int64)
+		for _, settings := range deckSettings {
+			id, err := restoreSettings(tx, &settings)
+			if err != nil {
+				return err
+			}
+			settingsIDs[settings.ID] = id
+		}
+
+		deckIDs := make(map[int64]int64)
+		for _, deck := range decks {
+			// Decks of older backups use the Default settings
+			deck.Settings = settingsIDs[deck.Settings]
+			id, err := restoreDeck(tx, deckUUIDs, &deck, opts.Merge)
+			if err != nil {
+				return err
+			}
+			deckIDs[deck.ID] = id
+		}
+
+		cardIDs := make(map[int64]int64)
+		for _, card := range cards {
+			deck, ok := deckIDs[card.Deck]
+			if !ok {
+				return fmt.Errorf("trana: backup card %d is in unknown deck %d", card.ID, card.Deck)
+			}
+			if card.Comfort != -1 && (card.Comfort < ComfortMin || card.Comfort > ComfortMax) {
+				return fmt.Errorf("trana: backup card %d: %w", card.ID, ErrBadComfort)
+			}
+			card.Front = cleanString(card.Front)
+			card.Back = cleanString(card.Back)
+
+			var id int64
+			var err error
+			if opts.Merge {
+				result := ImportResult{Card: card, Policy: ConflictAbort}
+				if id, err = stmts.importCard(deck, &result); err == nil && result.Status == ImportConflict {
+					err = fmt.Errorf("same front as existing card %d but a different back", id)
+				}
+			} else {
+				id, err = stmts.insertCard(deck, &card)
+			}
+			if err == nil {
+				err = restoreLearning(tx, id, card.Learning)
+			}
+			if err != nil {
+				return fmt.Errorf("trana: backup card %d: %w", card.ID, err)
+			}
+			cardIDs[card.ID] = id
+		}
+
+		for _, review := range reviews {
+			card, ok := cardIDs[review.Card]
+			if !ok {
+				return fmt.Errorf("trana: backup review %d is of unknown card %d", review.ID, review.Card)
+			}
+			if err := restoreReview(tx, card, &review); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if t.mediaDir != "" {
+		for _, f := range z.File {
+			name := path.Base(f.Name)
+			if !strings.HasPrefix(f.Name, "media/") || f.FileInfo().IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			if err = os.MkdirAll(t.mediaDir, 0700); err != nil {
+				return nil, err
+			}
+			if err = writeMedia(t.mediaDir, name, f.Open); err != nil {
+				return nil, err
+			}
+			result.Media++
+		}
+	}
+	return &result, nil
+}
+
+func readBackupFile(files map[string]*zip.File, name string, v any) error {
+	f := files[name]
+	if f == nil {
+		return fmt.Errorf("%w: missing %s", ErrNotBackup, name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err = json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("trana: backup %s: %w", name, err)
+	}
+	return nil
+}
+
+// restoreDeck creates a deck, or when merging reuses the first deck of the same
+// name, and returns its ID. Reused decks keep their settings.
+func restoreDeck(tx *sql.Tx, uuidUsed *sql.Stmt, deck *Deck, merge bool) (int64, error) {
+	name := cleanString(deck.Name)
+	if merge {
+		var id int64
+		err := tx.QueryRow(`SELECT "id"
+			FROM "decks"
+			WHERE "name" = @name AND "deleted" IS NULL
+			ORDER BY "id" ASC
+			LIMIT 1`, name).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+	uuid, err := freeUUID(uuidUsed, deck.UUID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixMilli()
+	var settings sql.NullInt64
+	if deck.Settings != 0 {
+		settings = sql.NullInt64{Int64: deck.Settings, Valid: true}
+	}
+	result, err := tx.Exec(`INSERT INTO "decks" ("uuid", "name", "learning_steps", "relearning_steps", "settings", "modified", "changed")
+		VALUES (@uuid, @name, @learning, @relearning, @settings, @now, @now)`, uuid, name, nullSteps(deck.LearningSteps), nullSteps(deck.RelearningSteps), settings, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// restoreSettings returns the ID of settings of the same name and fields, or
+// creates them, named apart from existing settings by a number.
+func restoreSettings(tx *sql.Tx, settings *DeckSettings) (int64, error) {
+	if !settings.valid() {
+		return 0, fmt.Errorf("trana: backup deck settings %d: %w", settings.ID, ErrBadSettings)
+	}
+	matching, err := nullMatching(settings.Matching)
+	if err != nil {
+		return 0, err
+	}
+	base := cleanString(settings.Name)
+	name := base
+	for n := 2; ; n++ {
+		var existing DeckSettings
+		err := scanSettings(tx.QueryRow(`SELECT `+settingsColumns+`
+			FROM "deck_settings"
+			WHERE "name" = @name`, name), &existing)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		existingMatching, err := nullMatching(existing.Matching)
+		if err != nil {
+			return 0, err
+		}
+		if existing.Scheduler == settings.Scheduler && existing.Direction == settings.Direction &&
+			existingMatching == matching && existing.Order == settings.Order &&
+			existing.NewLimit == settings.NewLimit && existing.ReviewLimit == settings.ReviewLimit {
+			return existing.ID, nil
+		}
+		name = fmt.Sprintf("%s %d", base, n)
+	}
+	result, err := tx.Exec(`INSERT INTO "deck_settings" ("name", "scheduler", "direction", "matching", "order", "new_limit", "review_limit", "modified")
+		VALUES (@name, @scheduler, @direction, @matching, @order, @newLimit, @reviewLimit, @now)`,
+		name, settings.Scheduler, settings.Direction, matching, settings.Order, settings.NewLimit, settings.ReviewLimit, time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// restoreLearning sets the learning step of a restored card, which imports do
+// not keep.
+func restoreLearning(tx *sql.Tx, card int64, l *Learning) error {
+	if l != nil && l.Step < 0 {
+		return fmt.Errorf("learning step %d", l.Step)
+	}
+	step, due, relearning := nullLearning(l)
+	_, err := tx.Exec(`UPDATE "cards"
+		SET "learning_step" = @step, "learning_due" = @due, "relearning" = @relearning
+		WHERE "id" = @id`, step, due, relearning, card)
+	return err
+}
+
+// restoreReview inserts a review, skipping reviews already restored by an
+// earlier merge.
+func restoreReview(tx *sql.Tx, card int64, review *Review) error {
+	if review.Comfort < ComfortReviewMin || review.Comfort > ComfortReviewMax {
+		return fmt.Errorf("trana: backup review %d: %w", review.ID, ErrBadComfort)
+	}
+	_, err := insertReview(tx, card, review, time.Now().UnixMilli())
+	return err
+}
+
+// insertReview inserts a review of the card unless the card has the same
+// review, and reports whether it did.
+func insertReview(tx *sql.Tx, card int64, review *Review, changed int64) (bool, error) {
+	var correct sql.NullBool
+	if review.Correct != nil {
+		correct.Valid = true
+		correct.Bool = *review.Correct
+	}
+	var duration sql.NullInt64
+	if review.Duration > 0 {
+		duration.Valid = true
+		duration.Int64 = review.Duration.Milliseconds()
+	}
+
+	result, err := tx.Exec(`INSERT INTO "reviews" ("card", "time", "comfort", "correct", "duration", "changed")
+		SELECT @card, @time, @comfort, @correct, @duration, @changed
+		WHERE NOT EXISTS (SELECT 1 FROM "reviews" WHERE "card" = @card AND "time" = @time AND "comfort" = @comfort)`,
+		sql.Named("card", card), sql.Named("time", review.Time.Unix()), sql.Named("comfort", review.Comfort),
+		sql.Named("correct", correct), sql.Named("duration", duration), sql.Named("changed", changed))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
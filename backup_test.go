@@ -0,0 +1,162 @@
+package trana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newBackupSource returns a collection with a deck using its own settings and
+// steps, a reviewed card, a card in learning and a suspended card.
+func newBackupSource(t *testing.T) *Trana {
+	t.Helper()
+	ctx := context.Background()
+	tr := newTestTrana(t)
+
+	deck, err := tr.CreateDeck(ctx, "Swedish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tr.SetLearningSteps(ctx, deck, []time.Duration{5 * time.Minute}, []time.Duration{}); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := tr.CreateDeckSettings(ctx, &DeckSettings{Name: "Slow", Order: OrderCreated, NewLimit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tr.UseDeckSettings(ctx, deck, settings); err != nil {
+		t.Fatal(err)
+	}
+
+	card, err := tr.CreateCard(ctx, deck, "hund", "dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.ReviewCard(ctx, card, ComfortReviewMax, nil); err != nil {
+		t.Fatal(err)
+	}
+	if card, err = tr.CreateCard(ctx, deck, "häst", "horse"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.ReviewCard(ctx, card, ComfortReviewMin, nil); err != nil {
+		t.Fatal(err)
+	}
+	if card, err = tr.CreateCard(ctx, deck, "katt", "cat"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tr.SuspendCard(ctx, card); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestRestore(t *testing.T) {
+	testcases := map[string]struct {
+		// Restore into the collection backed up, or into a new one
+		same  bool
+		merge bool
+
+		decks   int
+		cards   int
+		reviews int
+	}{
+		"new collection": {decks: 1, cards: 3, reviews: 2},
+		"same":           {same: true, decks: 2, cards: 6, reviews: 4},
+		"same merged":    {same: true, merge: true, decks: 1, cards: 3, reviews: 2},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			src := newBackupSource(t)
+			reviewed := cardsByFront(t, src)["hund"]
+			learning := cardsByFront(t, src)["häst"]
+			if learning.Learning == nil {
+				t.Fatal("häst is not in learning")
+			}
+			var buf bytes.Buffer
+			if err := src.Backup(ctx, &buf, json.RawMessage(`{"daily_goal":10}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := src
+			if !tc.same {
+				dst = newTestTrana(t)
+			}
+			result, err := dst.Restore(ctx, bytes.NewReader(buf.Bytes()), int64(buf.Len()), &RestoreOptions{Merge: tc.merge})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var settings bytes.Buffer
+			if err = json.Compact(&settings, result.Settings); err != nil {
+				t.Fatal(err)
+			}
+			if result.Decks != 1 || result.Cards != 3 || result.Reviews != 2 || settings.String() != `{"daily_goal":10}` {
+				t.Errorf("result %+v; want 1 deck, 3 cards, 2 reviews and the settings", result)
+			}
+
+			decks, err := dst.ListDecks(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decks) != tc.decks {
+				t.Fatalf("%d decks; want %d", len(decks), tc.decks)
+			}
+			cards := 0
+			for _, deck := range decks {
+				if len(deck.LearningSteps) != 1 || deck.LearningSteps[0] != 5*time.Minute || len(deck.RelearningSteps) != 0 {
+					t.Errorf("deck %d steps %v, %v; want [5m], []", deck.ID, deck.LearningSteps, deck.RelearningSteps)
+				}
+				settings, err := dst.GetDeckSettings(ctx, deck.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if settings.Name != "Slow" || settings.NewLimit != 5 || settings.Order != OrderCreated {
+					t.Errorf("deck %d settings %+v; want Slow", deck.ID, settings)
+				}
+
+				list, err := dst.ListCards(ctx, deck.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, card := range list {
+					switch card.Front {
+					case "hund":
+						if card.Back != "dog" || card.Comfort != reviewed.Comfort || !sameTime(card.LastPracticed, reviewed.LastPracticed) || card.Suspended {
+							t.Errorf("restored %+v; want hund reviewed", card)
+						}
+					case "häst":
+						want := learning.Learning
+						if l := card.Learning; l == nil || l.Step != want.Step || l.Relearning != want.Relearning || !l.Due.Equal(want.Due) {
+							t.Errorf("restored learning %+v; want %+v", card.Learning, want)
+						}
+					case "katt":
+						if card.Back != "cat" || card.Comfort != -1 || !card.Suspended {
+							t.Errorf("restored %+v; want katt suspended", card)
+						}
+					default:
+						t.Errorf("restored unknown card %+v", card)
+					}
+				}
+				cards += len(list)
+			}
+			if cards != tc.cards {
+				t.Errorf("%d cards; want %d", cards, tc.cards)
+			}
+			if got := countReviews(t, dst); got != tc.reviews {
+				t.Errorf("%d reviews; want %d", got, tc.reviews)
+			}
+
+			// Settings of the same name and fields are reused
+			presets, err := dst.ListDeckSettings(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(presets) != 2 {
+				t.Errorf("settings %+v; want Default and Slow", presets)
+			}
+		})
+	}
+}
@@ -0,0 +1,779 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/esote/trana"
+)
+
+const usage = `usage: trana [flags] [command]
+
+commands:
+	serve                            run the web server (default)
+	config show                      print the effective configuration
+	deck list                        list decks
+	deck create name                 create a deck
+	deck rename deck name            rename a deck
+	deck delete deck                 move a deck and its cards to the trash
+	deck steps [-learning s] [-relearning s] deck
+	                                 show or set the learning and relearning
+	                                 steps of a deck, such as "1m 10m 1h"
+	card list deck                   list the cards of a deck
+	card add deck front back         add a card to a deck
+	card edit [-front s] [-back s] [-tags s] card
+	                                 edit a card
+	card rm card                     move a card to the trash
+	card suspend|unsuspend card      stop or resume practicing a card
+	card bury|unbury card            skip or stop skipping a card until
+	                                 tomorrow
+	practice [-reverse|-random] deck practice a deck in the terminal
+	import [-front n] [-back n] [-tags n] [-comfort n]
+	       [-delimiter d] [-encoding e] [-header]
+	       [-conflict policy] [-dry-run] deck [file]
+	                                 import cards from JSON, CSV, TSV or Anki
+	                                 package file or stdin, mapping CSV
+	                                 columns or Anki note fields n to card
+	                                 fields, and report what was imported
+	export [-format json|apkg|csv|tsv|md|html] [-list] deck [file]
+	                                 export cards to file or stdout as JSON,
+	                                 Anki package, CSV, TSV, Markdown table
+	                                 (or definition list with -list) or
+	                                 printable HTML flashcards
+	backup [file]                    back up all decks, cards, review history,
+	                                 settings and media to a zip file or
+	                                 stdout
+	restore [-merge] [file]          restore a backup from file or stdin as
+	                                 new decks, or with -merge into decks of
+	                                 the same name
+	sync [-token t] url              sync decks, cards and review history
+	                                 both ways with the instance at url
+	trash list                       list deleted decks and cards, which are
+	                                 purged after the trash retention
+	trash restore deck|card id       take a deck or card out of the trash
+
+Decks are given by ID or name. Commands which print take -json for
+machine-readable output.
+
+flags:
+`
+
+func openTrana(dir string, cfg *config) (*trana.Trana, error) {
+	location, err := cfg.location()
+	if err != nil {
+		return nil, err
+	}
+	return trana.New(filepath.Join(dir, "trana.db"), &trana.Options{
+		Scheduler:      cfg.Scheduler,
+		MediaDir:       mediaDir(dir),
+		Location:       location,
+		TrashRetention: time.Duration(cfg.TrashRetention),
+		RepeatGap:      cfg.RepeatGap,
+		RepeatDelay:    time.Duration(cfg.RepeatDelay),
+		BurySiblings:   cfg.BurySiblings,
+	})
+}
+
+func mediaDir(dir string) string {
+	return filepath.Join(dir, "media")
+}
+
+// command is a subcommand operating on an open collection.
+type command struct {
+	flags *flag.FlagSet
+	json  bool
+
+	// Exact number of positional arguments, or -1 for min to max
+	nargs    int
+	min, max int
+
+	run func(ctx context.Context, t *trana.Trana, c *command, args []string) error
+}
+
+func newCommand(name string, nargs int, run func(context.Context, *trana.Trana, *command, []string) error) *command {
+	c := &command{
+		flags: flag.NewFlagSet(name, flag.ExitOnError),
+		nargs: nargs,
+		run:   run,
+	}
+	c.flags.BoolVar(&c.json, "json", false, "machine-readable output")
+	return c
+}
+
+func runCommand(dir string, cfg *config, c *command, args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	args = c.flags.Args()
+	if (c.nargs >= 0 && len(args) != c.nargs) || (c.nargs < 0 && (len(args) < c.min || len(args) > c.max)) {
+		return fmt.Errorf("%s: wrong number of arguments", c.flags.Name())
+	}
+
+	t, err := openTrana(dir, cfg)
+	if err != nil {
+		return err
+	}
+	err = c.run(context.Background(), t, c, args)
+	if err2 := t.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (c *command) print(v any, text func(w io.Writer)) error {
+	if c.json {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(v)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	text(w)
+	return w.Flush()
+}
+
+// findDeck looks up a deck by ID, falling back to its name.
+func findDeck(ctx context.Context, t *trana.Trana, arg string) (*trana.Deck, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		deck, err := t.GetDeck(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("deck %d not found", id)
+		}
+		return deck, err
+	}
+	decks, err := t.ListDecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found *trana.Deck
+	for i := range decks {
+		if decks[i].Name == arg {
+			if found != nil {
+				return nil, fmt.Errorf("deck name %q is ambiguous, use its ID", arg)
+			}
+			found = &decks[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("deck %q not found", arg)
+	}
+	return found, nil
+}
+
+func parseID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", arg)
+	}
+	return id, nil
+}
+
+func printDeck(c *command, deck *trana.Deck) error {
+	return c.print(deck, func(w io.Writer) {
+		fmt.Fprintf(w, "%d\t%s\n", deck.ID, deck.Name)
+	})
+}
+
+func printCards(c *command, cards []trana.Card) error {
+	if cards == nil {
+		cards = []trana.Card{}
+	}
+	return c.print(cards, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tFRONT\tBACK\tTAGS\tCOMFORT\tLAST PRACTICED\tSTATUS")
+		for _, card := range cards {
+			var lastPracticed string
+			if card.LastPracticed != nil {
+				lastPracticed = card.LastPracticed.Format(time.RFC3339)
+			}
+			var status []string
+			if card.Suspended {
+				status = append(status, "suspended")
+			}
+			if card.Buried() {
+				status = append(status, "buried")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%.2f\t%s\t%s\n", card.ID, card.Front, oneLine(card.Back), strings.Join(card.Tags, " "), card.Comfort, lastPracticed, strings.Join(status, " "))
+		}
+	})
+}
+
+// oneLine joins the alternatives of a back for tabular output.
+func oneLine(back string) string {
+	return strings.ReplaceAll(back, "\n", " / ")
+}
+
+func runDeck(dir string, cfg *config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("deck: missing subcommand")
+	}
+
+	var c *command
+	switch args[0] {
+	case "list":
+		c = newCommand("deck list", 0, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			decks, err := t.ListDecks(ctx)
+			if err != nil {
+				return err
+			}
+			if decks == nil {
+				decks = []trana.Deck{}
+			}
+			return c.print(decks, func(w io.Writer) {
+				fmt.Fprintln(w, "ID\tNAME")
+				for _, deck := range decks {
+					fmt.Fprintf(w, "%d\t%s\n", deck.ID, deck.Name)
+				}
+			})
+		})
+	case "create":
+		c = newCommand("deck create", 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			id, err := t.CreateDeck(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			deck, err := t.GetDeck(ctx, id)
+			if err != nil {
+				return err
+			}
+			return printDeck(c, deck)
+		})
+	case "rename":
+		c = newCommand("deck rename", 2, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			deck, err := findDeck(ctx, t, args[0])
+			if err != nil {
+				return err
+			}
+			deck.Name = args[1]
+			if err = t.UpdateDeck(ctx, deck); err != nil {
+				return err
+			}
+			if deck, err = t.GetDeck(ctx, deck.ID); err != nil {
+				return err
+			}
+			return printDeck(c, deck)
+		})
+	case "delete":
+		c = newCommand("deck delete", 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			deck, err := findDeck(ctx, t, args[0])
+			if err != nil {
+				return err
+			}
+			if err = t.DeleteDeck(ctx, deck.ID); errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("deck %s is already in the trash", args[0])
+			}
+			return err
+		})
+	case "steps":
+		var learning, relearning string
+		c = newCommand("deck steps", 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			deck, err := findDeck(ctx, t, args[0])
+			if err != nil {
+				return err
+			}
+			c.flags.Visit(func(f *flag.Flag) {
+				if err != nil {
+					return
+				}
+				switch f.Name {
+				case "learning":
+					deck.LearningSteps, err = trana.ParseSteps(learning)
+				case "relearning":
+					deck.RelearningSteps, err = trana.ParseSteps(relearning)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if err = t.SetLearningSteps(ctx, deck.ID, deck.LearningSteps, deck.RelearningSteps); err != nil {
+				return err
+			}
+			if deck, err = t.GetDeck(ctx, deck.ID); err != nil {
+				return err
+			}
+			return c.print(deck, func(w io.Writer) {
+				fmt.Fprintln(w, "ID\tNAME\tLEARNING\tRELEARNING")
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", deck.ID, deck.Name, trana.FormatSteps(deck.LearningSteps), trana.FormatSteps(deck.RelearningSteps))
+			})
+		})
+		c.flags.StringVar(&learning, "learning", "", "new learning steps, empty for none")
+		c.flags.StringVar(&relearning, "relearning", "", "new relearning steps, empty for none")
+	default:
+		return fmt.Errorf("deck: unknown subcommand %q", args[0])
+	}
+	return runCommand(dir, cfg, c, args[1:])
+}
+
+func runCard(dir string, cfg *config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("card: missing subcommand")
+	}
+
+	var c *command
+	switch args[0] {
+	case "list":
+		c = newCommand("card list", 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			deck, err := findDeck(ctx, t, args[0])
+			if err != nil {
+				return err
+			}
+			cards, err := t.ListCards(ctx, deck.ID)
+			if err != nil {
+				return err
+			}
+			return printCards(c, cards)
+		})
+	case "add":
+		c = newCommand("card add", 3, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			deck, err := findDeck(ctx, t, args[0])
+			if err != nil {
+				return err
+			}
+			id, err := t.CreateCard(ctx, deck.ID, args[1], args[2])
+			if err != nil {
+				return err
+			}
+			card, err := t.GetCard(ctx, id)
+			if err != nil {
+				return err
+			}
+			return printCards(c, []trana.Card{*card})
+		})
+	case "edit":
+		var front, back, tags string
+		c = newCommand("card edit", 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			card, err := t.GetCard(ctx, id)
+			if err != nil {
+				return err
+			}
+			c.flags.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "front":
+					card.Front = front
+				case "back":
+					card.Back = back
+				case "tags":
+					card.Tags = strings.Fields(tags)
+				}
+			})
+			if err = t.UpdateCard(ctx, card, trana.RevisionAPI); err != nil {
+				return err
+			}
+			if card, err = t.GetCard(ctx, id); err != nil {
+				return err
+			}
+			return printCards(c, []trana.Card{*card})
+		})
+		c.flags.StringVar(&front, "front", "", "new front")
+		c.flags.StringVar(&back, "back", "", "new back")
+		c.flags.StringVar(&tags, "tags", "", "new space separated tags")
+	case "rm":
+		c = newCommand("card rm", 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			if err = t.DeleteCard(ctx, id); errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("card %d not found", id)
+			}
+			return err
+		})
+	case "suspend", "unsuspend", "bury", "unbury":
+		state := args[0]
+		c = newCommand("card "+state, 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			set := map[string]func(context.Context, int64) error{
+				"suspend":   t.SuspendCard,
+				"unsuspend": t.UnsuspendCard,
+				"bury":      t.BuryCard,
+				"unbury":    t.UnburyCard,
+			}[state]
+			err = set(ctx, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("card %d not found", id)
+			}
+			if err != nil {
+				return err
+			}
+			card, err := t.GetCard(ctx, id)
+			if err != nil {
+				return err
+			}
+			return printCards(c, []trana.Card{*card})
+		})
+	default:
+		return fmt.Errorf("card: unknown subcommand %q", args[0])
+	}
+	return runCommand(dir, cfg, c, args[1:])
+}
+
+func runImport(dir string, cfg *config, args []string) error {
+	var opts trana.ImportOptions
+	mapping := trana.DefaultAnkiMapping
+	var tags, comfort int
+	var delimiter, encoding string
+	var header bool
+	c := newCommand("import", -1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+		deck, err := findDeck(ctx, t, args[0])
+		if err != nil {
+			return err
+		}
+
+		// JSON is read as it is imported, other formats need the whole file
+		var in io.Reader = os.Stdin
+		var at io.ReaderAt
+		var size int64
+		if len(args) == 2 {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			in, at, size = f, f, fi.Size()
+		}
+		br := bufio.NewReader(in)
+
+		format, err := detectFormat(br)
+		if err != nil {
+			return err
+		}
+		if format == formatAnki && at == nil {
+			b, err := io.ReadAll(br)
+			if err != nil {
+				return err
+			}
+			at, size = bytes.NewReader(b), int64(len(b))
+		}
+
+		// Progress ends its line before the report or an error is printed
+		progress := false
+		endProgress := func() {
+			if progress {
+				fmt.Fprintln(os.Stderr)
+				progress = false
+			}
+		}
+		if isTerminal(os.Stderr) {
+			opts.Progress = func(n int) {
+				fmt.Fprintf(os.Stderr, "\r%d cards", n)
+				progress = true
+			}
+			defer endProgress()
+		}
+
+		var report *trana.ImportReport
+		switch format {
+		case formatAnki:
+			pkg, err := trana.OpenAnki(at, size)
+			if err != nil {
+				return err
+			}
+			// The fields given by flags are used for every model
+			mappings := make(map[int64]trana.AnkiMapping)
+			for _, m := range pkg.Models() {
+				mappings[m.ID] = mapping
+			}
+			if report, err = t.ImportAnki(ctx, deck.ID, pkg, mappings, &opts); err != nil {
+				return err
+			}
+		case formatCSV:
+			data, err := io.ReadAll(br)
+			if err != nil {
+				return err
+			}
+			csvOpts := trana.DetectCSV(data)
+			var csvMapping trana.CSVMapping
+			c.flags.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "delimiter":
+					csvOpts.Delimiter, err = parseDelimiter(delimiter)
+				case "encoding":
+					csvOpts.Encoding = encoding
+				case "header":
+					csvOpts.Header = header
+				}
+			})
+			if err != nil {
+				return err
+			}
+			f, err := trana.ReadCSV(bytes.NewReader(data), csvOpts)
+			if err != nil {
+				return err
+			}
+			csvMapping = f.DefaultMapping()
+			c.flags.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "front":
+					csvMapping.Front = mapping.Front
+				case "back":
+					csvMapping.Back = mapping.Back
+				case "tags":
+					csvMapping.Tags = tags
+				case "comfort":
+					csvMapping.Comfort = comfort
+				}
+			})
+			cards, err := f.Cards(csvMapping)
+			if err != nil {
+				return err
+			}
+			if report, err = t.ImportCards(ctx, deck.ID, cards, &opts); err != nil {
+				return err
+			}
+		default:
+			er, err := trana.NewExportReader(br)
+			if err != nil {
+				return err
+			}
+			if report, err = t.ImportFrom(ctx, deck.ID, er, &opts); err != nil {
+				return err
+			}
+		}
+		endProgress()
+		return printReport(c, report)
+	})
+	c.min, c.max = 1, 2
+	c.flags.IntVar(&mapping.Front, "front", mapping.Front, "CSV column or Anki note field used as front")
+	c.flags.IntVar(&mapping.Back, "back", mapping.Back, "CSV column or Anki note field used as back")
+	c.flags.IntVar(&tags, "tags", -1, "CSV column used as tags")
+	c.flags.IntVar(&comfort, "comfort", -1, "CSV column used as comfort")
+	c.flags.StringVar(&delimiter, "delimiter", "", "CSV delimiter: comma, tab or semicolon (default detected)")
+	c.flags.StringVar(&encoding, "encoding", "", "CSV encoding: "+strings.Join(trana.CSVEncodings, ", ")+" (default detected)")
+	c.flags.BoolVar(&header, "header", false, "CSV first row is a header (default detected)")
+	c.flags.StringVar((*string)(&opts.Conflict), "conflict", "", "resolve cards with the same front but a different back: keep, overwrite, both or merge (default fail)")
+	c.flags.BoolVar(&opts.DryRun, "dry-run", false, "report what would be imported without importing")
+	return runCommand(dir, cfg, c, args)
+}
+
+func printReport(c *command, report *trana.ImportReport) error {
+	return c.print(report, func(w io.Writer) {
+		for _, r := range report.Conflicting {
+			fmt.Fprintf(w, "conflict\tcard %d\t%s\t%s\t(existing: %s)\n", r.Index, r.Card.Front, oneLine(r.Card.Back), oneLine(r.Existing.Back))
+		}
+		fmt.Fprintf(w, "inserted\t%d\n", report.Inserted)
+		fmt.Fprintf(w, "updated\t%d\n", report.Updated)
+		fmt.Fprintf(w, "unchanged\t%d\n", report.Unchanged)
+		fmt.Fprintf(w, "conflicting\t%d\n", report.Conflicts)
+		if report.Skipped > 0 {
+			fmt.Fprintf(w, "skipped\t%d\n", report.Skipped)
+		}
+	})
+}
+
+func runExport(dir string, cfg *config, args []string) error {
+	var format string
+	var list bool
+	c := newCommand("export", -1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+		deck, err := findDeck(ctx, t, args[0])
+		if err != nil {
+			return err
+		}
+
+		var templates map[string]*template.Template
+		if format == formatHTML {
+			static, err := loadStatic()
+			if err != nil {
+				return err
+			}
+			if templates, err = loadTemplates(static); err != nil {
+				return err
+			}
+		}
+
+		out := os.Stdout
+		if len(args) == 2 {
+			if out, err = os.Create(args[1]); err != nil {
+				return err
+			}
+		}
+
+		err = exportCards(ctx, t, templates, deck, format, list, out)
+		if out != os.Stdout {
+			if err2 := out.Close(); err == nil {
+				err = err2
+			}
+		}
+		return err
+	})
+	c.min, c.max = 1, 2
+	c.flags.StringVar(&format, "format", formatJSON, "export format")
+	c.flags.BoolVar(&list, "list", false, "write Markdown as a definition list instead of a table")
+	return runCommand(dir, cfg, c, args)
+}
+
+func runBackup(dir, configFile string, cfg *config, args []string) error {
+	c := newCommand("backup", -1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+		settings, err := os.ReadFile(configFile)
+		if errors.Is(err, os.ErrNotExist) {
+			settings, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if len(args) == 1 {
+			if out, err = os.Create(args[0]); err != nil {
+				return err
+			}
+		}
+		err = t.Backup(ctx, out, settings)
+		if out != os.Stdout {
+			if err2 := out.Close(); err == nil {
+				err = err2
+			}
+		}
+		return err
+	})
+	c.min, c.max = 0, 1
+	return runCommand(dir, cfg, c, args)
+}
+
+func runRestore(dir, configFile string, cfg *config, args []string) error {
+	var opts trana.RestoreOptions
+	c := newCommand("restore", -1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+		var in io.ReaderAt
+		var size int64
+		if len(args) == 1 {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			in, size = f, fi.Size()
+		} else {
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			in, size = bytes.NewReader(b), int64(len(b))
+		}
+
+		result, err := t.Restore(ctx, in, size, &opts)
+		if err != nil {
+			return err
+		}
+
+		// The settings of the backup are only used if there are none yet
+		settings := "none"
+		if result.Settings != nil {
+			settings = "kept existing " + configFile
+			f, err := os.OpenFile(configFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err == nil {
+				_, err = f.Write(result.Settings)
+				if err2 := f.Close(); err == nil {
+					err = err2
+				}
+				if err != nil {
+					return err
+				}
+				settings = "restored to " + configFile
+			} else if !errors.Is(err, os.ErrExist) {
+				return err
+			}
+		}
+
+		return c.print(result, func(w io.Writer) {
+			fmt.Fprintf(w, "decks\t%d\n", result.Decks)
+			fmt.Fprintf(w, "cards\t%d\n", result.Cards)
+			fmt.Fprintf(w, "reviews\t%d\n", result.Reviews)
+			fmt.Fprintf(w, "media\t%d\n", result.Media)
+			fmt.Fprintf(w, "settings\t%s\n", settings)
+		})
+	})
+	c.min, c.max = 0, 1
+	c.flags.BoolVar(&opts.Merge, "merge", false, "merge into decks of the same name")
+	return runCommand(dir, cfg, c, args)
+}
+
+func runTrash(dir string, cfg *config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("trash: missing subcommand")
+	}
+
+	var c *command
+	switch args[0] {
+	case "list":
+		c = newCommand("trash list", 0, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			trash, err := t.ListTrash(ctx)
+			if err != nil {
+				return err
+			}
+			return c.print(trash, func(w io.Writer) {
+				fmt.Fprintln(w, "KIND\tID\tNAME\tDELETED\tPURGED")
+				for _, deck := range trash.Decks {
+					fmt.Fprintf(w, "deck\t%d\t%s\t%s\t%s\n", deck.Deck.ID, deck.Deck.Name, deck.Deleted.Format(time.RFC3339), deck.Purged.Format(time.RFC3339))
+				}
+				for _, card := range trash.Cards {
+					fmt.Fprintf(w, "card\t%d\t%s\t%s\t%s\n", card.Card.ID, card.Card.Front, card.Deleted.Format(time.RFC3339), card.Purged.Format(time.RFC3339))
+				}
+			})
+		})
+	case "restore":
+		c = newCommand("trash restore", 2, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			id, err := parseID(args[1])
+			if err != nil {
+				return err
+			}
+			switch args[0] {
+			case "deck":
+				err = t.RestoreDeck(ctx, id)
+			case "card":
+				err = t.RestoreCard(ctx, id)
+			default:
+				return fmt.Errorf("trash restore: unknown kind %q", args[0])
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%s %d is not in the trash", args[0], id)
+			}
+			return err
+		})
+	default:
+		return fmt.Errorf("trash: unknown subcommand %q", args[0])
+	}
+	return runCommand(dir, cfg, c, args[1:])
+}
+
+func runSync(dir string, cfg *config, args []string) error {
+	token := cfg.Sync.Token
+	c := newCommand("sync", 1, func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+		result, err := t.SyncPeer(ctx, args[0], syncExchange(ctx, args[0], token))
+		if err != nil {
+			return err
+		}
+		return c.print(result, func(w io.Writer) {
+			fmt.Fprintf(w, "sent\t%d\n", result.Sent)
+			fmt.Fprintf(w, "received\t%d\n", result.Received)
+			fmt.Fprintf(w, "applied\t%d\n", result.Applied)
+		})
+	})
+	c.flags.StringVar(&token, "token", token, "sync token of the peer")
+	return runCommand(dir, cfg, c, args)
+}
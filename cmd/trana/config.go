@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/esote/trana"
+)
+
+const configName = "trana.json"
+
+type config struct {
+	Listen listenConfig `json:"listen"`
+
+	// Default scheduler used by NextCard
+	Scheduler trana.Scheduler `json:"scheduler"`
+
+	// Practice mode used by the practice button, one of "normal",
+	// "reverse", or "random"
+	PracticeMode string `json:"practice_mode"`
+
+	Matching trana.Matching `json:"matching"`
+
+	Log logConfig `json:"log"`
+
+	Sync syncConfig `json:"sync"`
+
+	// Time allowed for in-flight requests to finish when shutting down
+	ShutdownTimeout duration `json:"shutdown_timeout"`
+
+	// Largest accepted upload in bytes
+	MaxUpload int64 `json:"max_upload"`
+
+	// Reviews per day which continue a streak
+	DailyGoal int `json:"daily_goal"`
+
+	// Time deleted decks and cards are kept in the trash before they are
+	// purged
+	TrashRetention duration `json:"trash_retention"`
+
+	// Number of other cards practiced, and time waited, before a reviewed
+	// card is shown again. Zero disables either.
+	RepeatGap   int      `json:"repeat_gap"`
+	RepeatDelay duration `json:"repeat_delay"`
+
+	// Bury the reversed twin of a reviewed card until the next day
+	BurySiblings bool `json:"bury_siblings"`
+
+	// IANA time zone, such as "Europe/Stockholm", in which days of
+	// statistics and streaks start. Defaults to the local time zone.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+type logConfig struct {
+	// Log each HTTP request
+	Requests bool `json:"requests"`
+
+	// Append logs to file instead of stderr
+	File string `json:"file,omitempty"`
+}
+
+type syncConfig struct {
+	// Token which peers must present to sync with this instance, and which
+	// is presented to peers. Sync is refused by the server if empty.
+	Token string `json:"token,omitempty"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		Listen: listenConfig{
+			Addr:     "localhost:8080",
+			UnixMode: 0660,
+		},
+		Scheduler:    trana.SchedulerComfort,
+		PracticeMode: "normal",
+		Log: logConfig{
+			Requests: true,
+		},
+		ShutdownTimeout: duration(10 * time.Second),
+		MaxUpload:       256 << 20,
+		DailyGoal:       20,
+		TrashRetention:  duration(trana.DefaultTrashRetention),
+		RepeatGap:       3,
+		BurySiblings:    true,
+	}
+}
+
+// loadConfig reads the config file at path into c. A missing file is not an
+// error.
+func loadConfig(c *config, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err = d.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *config) validate() error {
+	if !c.Scheduler.Valid() {
+		return fmt.Errorf("unknown scheduler %q", c.Scheduler)
+	}
+	if c.ShutdownTimeout < 0 {
+		return errors.New("shutdown timeout must not be negative")
+	}
+	if c.MaxUpload <= 0 {
+		return errors.New("max upload must be positive")
+	}
+	if c.TrashRetention <= 0 {
+		return errors.New("trash retention must be positive")
+	}
+	if c.RepeatGap < 0 {
+		return errors.New("repeat gap must not be negative")
+	}
+	if c.RepeatDelay < 0 {
+		return errors.New("repeat delay must not be negative")
+	}
+	if c.DailyGoal <= 0 {
+		return errors.New("daily goal must be positive")
+	}
+	if _, err := c.location(); err != nil {
+		return err
+	}
+	switch c.PracticeMode {
+	case "normal", "reverse", "random":
+	default:
+		return fmt.Errorf("unknown practice mode %q", c.PracticeMode)
+	}
+	return nil
+}
+
+// location is the time zone of Timezone.
+func (c *config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+func (c *config) show() error {
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "\t")
+	return e.Encode(c)
+}
+
+// duration is a time.Duration usable as a flag and written as a string such
+// as "10s" in the config file.
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+func runConfig(c *config, args []string) error {
+	if len(args) != 1 || args[0] != "show" {
+		return errors.New("usage: trana config show")
+	}
+	return c.show()
+}
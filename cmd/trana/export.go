@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/esote/trana"
+)
+
+const (
+	formatTSV      = "tsv"
+	formatMarkdown = "md"
+	formatHTML     = "html"
+)
+
+// exportTypes maps export formats to their content type.
+var exportTypes = map[string]string{
+	formatJSON:     "application/json",
+	formatAnki:     "application/octet-stream",
+	formatCSV:      "text/csv; charset=utf-8",
+	formatTSV:      "text/tab-separated-values; charset=utf-8",
+	formatMarkdown: "text/markdown; charset=utf-8",
+	formatHTML:     "text/html; charset=utf-8",
+}
+
+// exportCards writes the cards of a deck in format. Markdown is written as a
+// definition list if list is set, otherwise as a table.
+func exportCards(ctx context.Context, t *trana.Trana, templates map[string]*template.Template, deck *trana.Deck, format string, list bool, w io.Writer) error {
+	if format == formatAnki {
+		return t.ExportAnki(ctx, deck.ID, w)
+	}
+	if _, ok := exportTypes[format]; !ok {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	if format == formatJSON {
+		f, err := t.Export(ctx, deck.ID)
+		if err != nil {
+			return err
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		return e.Encode(f)
+	}
+
+	cards, err := t.ListCards(ctx, deck.ID)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case formatCSV:
+		return trana.WriteCSV(w, cards, ',')
+	case formatTSV:
+		return trana.WriteCSV(w, cards, '\t')
+	case formatMarkdown:
+		return trana.WriteMarkdown(w, deck.Name, cards, list)
+	default:
+		return templates["export_print.html"].ExecuteTemplate(w, "print", newExportPrint(deck, cards))
+	}
+}
+
+const (
+	printColumns = 3
+	printRows    = 4
+)
+
+// ExportPrint lays out cards to be printed double-sided and cut out. Each
+// sheet has a page of fronts followed by a page of backs, on which the columns
+// of each row are mirrored so each back lands behind its front when flipped on
+// the long edge.
+type ExportPrint struct {
+	Deck   *trana.Deck
+	Sheets []printSheet
+}
+
+type printSheet struct {
+	Fronts [][]string
+	Backs  [][]string
+}
+
+func newExportPrint(deck *trana.Deck, cards []trana.Card) *ExportPrint {
+	page := &ExportPrint{Deck: deck}
+	perSheet := printColumns * printRows
+	for len(cards) > 0 {
+		n := perSheet
+		if len(cards) < n {
+			n = len(cards)
+		}
+
+		var sheet printSheet
+		for row := 0; row*printColumns < n; row++ {
+			fronts := make([]string, printColumns)
+			backs := make([]string, printColumns)
+			for col := 0; col < printColumns; col++ {
+				if i := row*printColumns + col; i < n {
+					fronts[col] = cards[i].Front
+					backs[printColumns-1-col] = cards[i].Back
+				}
+			}
+			sheet.Fronts = append(sheet.Fronts, fronts)
+			sheet.Backs = append(sheet.Backs, backs)
+		}
+		page.Sheets = append(page.Sheets, sheet)
+		cards = cards[n:]
+	}
+	return page
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/esote/trana"
+)
+
+const (
+	formatJSON = "json"
+	formatAnki = "apkg"
+	formatCSV  = "csv"
+)
+
+// detectFormat guesses the import format from the start of a file, without
+// consuming it.
+func detectFormat(br *bufio.Reader) (string, error) {
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return formatAnki, nil
+	}
+	text := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if bytes.HasPrefix(text, []byte("[")) || bytes.HasPrefix(text, []byte("{")) {
+		return formatJSON, nil
+	}
+	return formatCSV, nil
+}
+
+type ImportAnki struct {
+	Deck   *trana.Deck
+	Upload string
+	Models []trana.AnkiModel
+
+	// Mapping first offered for each model
+	Mapping trana.AnkiMapping
+
+	// Error opening the package
+	Error string
+
+	Policies []struct {
+		Policy trana.ImportPolicy
+		Label  string
+	}
+}
+
+func (s *server) ImportAnki(w http.ResponseWriter, r *http.Request) {
+	deck, err := strconv.ParseInt(r.URL.Query().Get("deck"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	page := ImportAnki{
+		Upload:   r.URL.Query().Get("upload"),
+		Mapping:  trana.DefaultAnkiMapping,
+		Policies: importPolicies,
+	}
+
+	page.Deck, err = s.trana.GetDeck(r.Context(), deck)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, size, err := s.uploads.open(page.Upload)
+	if uploadExpired(w, err) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if pkg, err := trana.OpenAnki(f, size); err != nil {
+		page.Error = err.Error()
+	} else {
+		page.Models = pkg.Models()
+	}
+
+	if err = s.template("import_anki", w, r, &page); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *server) ImportAnkiSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	deck, err := strconv.ParseInt(r.Form.Get("deck"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token := r.Form.Get("upload")
+	f, size, err := s.uploads.open(token)
+	if uploadExpired(w, err) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	opts, err := importOptions(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pkg, err := trana.OpenAnki(f, size)
+	if err != nil {
+		page := ImportAnki{
+			Upload:   token,
+			Mapping:  trana.DefaultAnkiMapping,
+			Policies: importPolicies,
+			Error:    err.Error(),
+		}
+		if page.Deck, err = s.trana.GetDeck(r.Context(), deck); err != nil {
+			log.Fatal(err)
+		}
+		if err = s.template("import_anki", w, r, &page); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	mappings := make(map[int64]trana.AnkiMapping)
+	for _, m := range pkg.Models() {
+		var mapping trana.AnkiMapping
+		id := strconv.FormatInt(m.ID, 10)
+		if mapping.Front, err = strconv.Atoi(r.Form.Get("front-" + id)); err != nil {
+			http.Error(w, "no front field chosen for "+m.Name, http.StatusBadRequest)
+			return
+		}
+		if mapping.Back, err = strconv.Atoi(r.Form.Get("back-" + id)); err != nil {
+			http.Error(w, "no back field chosen for "+m.Name, http.StatusBadRequest)
+			return
+		}
+		mappings[m.ID] = mapping
+	}
+	if _, err = s.trana.ImportAnki(r.Context(), deck, pkg, mappings, opts); err != nil {
+		log.Fatal(err)
+	}
+	s.uploads.remove(token)
+
+	url := url.URL{
+		Path: "/cards",
+	}
+	query := url.Query()
+	query.Add("deck", r.Form.Get("deck"))
+	url.RawQuery = query.Encode()
+
+	http.Redirect(w, r, url.String(), http.StatusSeeOther)
+}
+
+// csvDelimiters names delimiters for forms and flags.
+var csvDelimiters = []struct {
+	Name      string
+	Delimiter rune
+}{
+	{"comma", ','},
+	{"tab", '\t'},
+	{"semicolon", ';'},
+}
+
+func parseDelimiter(name string) (rune, error) {
+	for _, d := range csvDelimiters {
+		if d.Name == name {
+			return d.Delimiter, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown delimiter %q", name)
+}
+
+func delimiterName(delimiter rune) string {
+	for _, d := range csvDelimiters {
+		if d.Delimiter == delimiter {
+			return d.Name
+		}
+	}
+	return ""
+}
+
+// parseColumn parses an optional column index, -1 if unused.
+func parseColumn(s string) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// readCSVForm parses an uploaded CSV file with the options and mapping of a
+// form, or detected ones if the form was not submitted yet.
+func readCSVForm(v url.Values, data []byte) (*trana.CSVFile, trana.CSVMapping, error) {
+	var mapping trana.CSVMapping
+	opts := trana.DetectCSV(data)
+	submitted := v.Has("encoding")
+	if submitted {
+		var err error
+		opts.Encoding = v.Get("encoding")
+		opts.Header = v.Get("header") == "true"
+		if opts.Delimiter, err = parseDelimiter(v.Get("delimiter")); err != nil {
+			return nil, mapping, err
+		}
+	}
+
+	f, err := trana.ReadCSV(bytes.NewReader(data), opts)
+	if err != nil {
+		return nil, mapping, err
+	}
+
+	mapping = f.DefaultMapping()
+	if submitted {
+		for _, c := range []struct {
+			name string
+			dst  *int
+		}{
+			{"front", &mapping.Front},
+			{"back", &mapping.Back},
+			{"tags", &mapping.Tags},
+			{"comfort", &mapping.Comfort},
+		} {
+			if *c.dst, err = parseColumn(v.Get(c.name)); err != nil {
+				return nil, mapping, err
+			}
+		}
+	}
+	return f, mapping, nil
+}
+
+// csvField is a card field chosen from the columns of a CSV file.
+type csvField struct {
+	Name     string
+	Label    string
+	Selected int
+	Required bool
+}
+
+// csvPreviewRows is the number of cards shown before importing.
+const csvPreviewRows = 10
+
+type ImportCSV struct {
+	Deck   *trana.Deck
+	Upload string
+
+	Delimiter  string
+	Delimiters []string
+	Encodings  []string
+	Options    trana.CSVOptions
+	Columns    []string
+	Fields     []csvField
+
+	// Error parsing or mapping the file
+	Error string
+
+	Count   int
+	Preview []trana.Card
+	Review  *importReview
+}
+
+func (s *server) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	deck, err := strconv.ParseInt(r.URL.Query().Get("deck"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := s.uploads.read(r.URL.Query().Get("upload"))
+	if uploadExpired(w, err) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	page := s.importCSVPage(r.Context(), deck, r.URL.Query(), data)
+	if err = s.template("import_csv", w, r, page); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// importCSVPage reviews importing a CSV upload with the options and mapping of
+// a form.
+func (s *server) importCSVPage(ctx context.Context, deck int64, form url.Values, data []byte) *ImportCSV {
+	page := ImportCSV{
+		Upload:    form.Get("upload"),
+		Encodings: trana.CSVEncodings,
+	}
+	for _, d := range csvDelimiters {
+		page.Delimiters = append(page.Delimiters, d.Name)
+	}
+
+	var err error
+	page.Deck, err = s.trana.GetDeck(ctx, deck)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, mapping, err := readCSVForm(form, data)
+	if err != nil {
+		page.Error = err.Error()
+	} else {
+		page.Options = f.Options
+		page.Delimiter = delimiterName(f.Options.Delimiter)
+		page.Columns = f.Columns
+		page.Fields = []csvField{
+			{"front", "Front", mapping.Front, true},
+			{"back", "Back", mapping.Back, true},
+			{"tags", "Tags", mapping.Tags, false},
+			{"comfort", "Comfort", mapping.Comfort, false},
+		}
+
+		cards, err := f.Cards(mapping)
+		if err != nil {
+			page.Error = err.Error()
+		}
+		page.Count = len(cards)
+		page.Preview = cards
+		if len(page.Preview) > csvPreviewRows {
+			page.Preview = page.Preview[:csvPreviewRows]
+		}
+		if page.Review, err = s.reviewImport(ctx, deck, cards, form); err != nil {
+			page.Error = reviewError(err)
+		}
+	}
+	return &page
+}
+
+func (s *server) ImportCSVSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	deck, err := strconv.ParseInt(r.Form.Get("deck"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token := r.Form.Get("upload")
+	data, err := s.uploads.read(token)
+	if uploadExpired(w, err) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Failures are shown with the review of the import, to fix the form
+	failed := func(err string) {
+		page := s.importCSVPage(r.Context(), deck, r.Form, data)
+		page.Error = err
+		if err := s.template("import_csv", w, r, page); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	f, mapping, err := readCSVForm(r.Form, data)
+	if err != nil {
+		failed(err.Error())
+		return
+	}
+	cards, err := f.Cards(mapping)
+	if err != nil {
+		failed(err.Error())
+		return
+	}
+	opts, err := importOptions(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err = s.trana.ImportCards(r.Context(), deck, cards, opts); err != nil {
+		failed(reviewError(err))
+		return
+	}
+	s.uploads.remove(token)
+
+	url := url.URL{
+		Path: "/cards",
+	}
+	query := url.Query()
+	query.Add("deck", r.Form.Get("deck"))
+	url.RawQuery = query.Encode()
+
+	http.Redirect(w, r, url.String(), http.StatusSeeOther)
+}
+
+// importPolicies are the conflict policies offered when reviewing an import.
+var importPolicies = []struct {
+	Policy trana.ImportPolicy
+	Label  string
+}{
+	{trana.ConflictKeep, "Keep existing"},
+	{trana.ConflictOverwrite, "Overwrite"},
+	{trana.ConflictBoth, "Keep both"},
+	{trana.ConflictMerge, "Merge backs"},
+}
+
+// importOptions parses the conflict policies of an import review form. The
+// default policy is conflict, single cards are resolved by policy-<index>.
+func importOptions(v url.Values) (*trana.ImportOptions, error) {
+	opts := trana.ImportOptions{
+		Conflict: trana.ImportPolicy(v.Get("conflict")),
+		Policies: make(map[int]trana.ImportPolicy),
+	}
+	if opts.Conflict == trana.ConflictAbort {
+		opts.Conflict = trana.ConflictKeep
+	}
+	for key := range v {
+		if !strings.HasPrefix(key, "policy-") || v.Get(key) == "" {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(key, "policy-"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", trana.ErrBadImportPolicy, key)
+		}
+		opts.Policies[i] = trana.ImportPolicy(v.Get(key))
+	}
+
+	if !opts.Conflict.Valid() {
+		return nil, trana.ErrBadImportPolicy
+	}
+	for _, p := range opts.Policies {
+		if !p.Valid() {
+			return nil, trana.ErrBadImportPolicy
+		}
+	}
+	return &opts, nil
+}
+
+// importReview is the dry run of an import, shown before importing.
+type importReview struct {
+	Report    *trana.ImportReport
+	Conflicts []trana.ImportResult
+	Options   *trana.ImportOptions
+	Policies  []struct {
+		Policy trana.ImportPolicy
+		Label  string
+	}
+}
+
+func (s *server) reviewImport(ctx context.Context, deck int64, cards []trana.Card, v url.Values) (*importReview, error) {
+	return newImportReview(v, func(opts *trana.ImportOptions) (*trana.ImportReport, error) {
+		return s.trana.ImportCards(ctx, deck, cards, opts)
+	})
+}
+
+// reviewImportFrom is reviewImport for cards read one at a time.
+func (s *server) reviewImportFrom(ctx context.Context, deck int64, r trana.CardReader, v url.Values) (*importReview, error) {
+	return newImportReview(v, func(opts *trana.ImportOptions) (*trana.ImportReport, error) {
+		return s.trana.ImportFrom(ctx, deck, r, opts)
+	})
+}
+
+func newImportReview(v url.Values, dryRun func(*trana.ImportOptions) (*trana.ImportReport, error)) (*importReview, error) {
+	opts, err := importOptions(v)
+	if err != nil {
+		return nil, err
+	}
+	opts.DryRun = true
+
+	report, err := dryRun(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &importReview{
+		Report:    report,
+		Conflicts: report.Conflicting,
+		Options:   opts,
+		Policies:  importPolicies,
+	}, nil
+}
+
+// reviewError returns the message of an invalid file, card or policy or a
+// cancelled review, other errors are fatal.
+func reviewError(err error) string {
+	var cardErr *trana.CardError
+	switch {
+	case errors.As(err, &cardErr):
+	case errors.Is(err, trana.ErrBadExport), errors.Is(err, trana.ErrExportVersion):
+	case errors.Is(err, trana.ErrBadImportPolicy), errors.Is(err, context.Canceled):
+	default:
+		log.Fatal(err)
+	}
+	return err.Error()
+}
+
+type ImportJSON struct {
+	Deck   *trana.Deck
+	Upload string
+
+	// Name of the exported deck
+	Name string
+
+	// Error reading the file
+	Error string
+
+	Count  int
+	Review *importReview
+}
+
+func (s *server) ImportJSON(w http.ResponseWriter, r *http.Request) {
+	deck, err := strconv.ParseInt(r.URL.Query().Get("deck"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, _, err := s.uploads.open(r.URL.Query().Get("upload"))
+	if uploadExpired(w, err) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	page := s.importJSONPage(r.Context(), deck, r.URL.Query(), f)
+	if err = s.template("import_json", w, r, page); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// importJSONPage reviews importing an export with the options of a form.
+func (s *server) importJSONPage(ctx context.Context, deck int64, form url.Values, f io.Reader) *ImportJSON {
+	page := ImportJSON{
+		Upload: form.Get("upload"),
+	}
+
+	var err error
+	page.Deck, err = s.trana.GetDeck(ctx, deck)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	er, err := trana.NewExportReader(f)
+	if err != nil {
+		page.Error = reviewError(err)
+	} else if page.Review, err = s.reviewImportFrom(ctx, deck, er, form); err != nil {
+		page.Error = reviewError(err)
+	} else {
+		page.Name = er.File.Deck.Name
+		report := page.Review.Report
+		page.Count = report.Inserted + report.Updated + report.Unchanged + report.Conflicts
+	}
+	return &page
+}
+
+func (s *server) ImportJSONSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	deck, err := strconv.ParseInt(r.Form.Get("deck"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token := r.Form.Get("upload")
+	f, _, err := s.uploads.open(token)
+	if uploadExpired(w, err) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Failures are shown with the review of the import, read from the start
+	failed := func(err error) {
+		msg := reviewError(err)
+		f, _, err := s.uploads.open(token)
+		if uploadExpired(w, err) {
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		page := s.importJSONPage(r.Context(), deck, r.Form, f)
+		page.Error = msg
+		if err = s.template("import_json", w, r, page); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	opts, err := importOptions(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	er, err := trana.NewExportReader(f)
+	if err != nil {
+		failed(err)
+		return
+	}
+	if _, err = s.trana.ImportFrom(r.Context(), deck, er, opts); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		failed(err)
+		return
+	}
+	s.uploads.remove(token)
+
+	url := url.URL{
+		Path: "/cards",
+	}
+	query := url.Query()
+	query.Add("deck", r.Form.Get("deck"))
+	url.RawQuery = query.Encode()
+
+	http.Redirect(w, r, url.String(), http.StatusSeeOther)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestImportBadFile(t *testing.T) {
+	testcases := map[string]struct {
+		file string
+
+		// Page the upload is reviewed on
+		path string
+	}{
+		"json":             {file: `{"cards":[],"format":"x"}`, path: "/import/json"},
+		"json newer":       {file: `{"cards":[],"format":"trana-deck","version":99}`, path: "/import/json"},
+		"json truncated":   {file: `[{"front":"hund"`, path: "/import/json"},
+		"anki not a zip":   {file: "PK\x03\x04 not a zip", path: "/import/apkg"},
+		"csv one column":   {file: "hund\nkatt\n", path: "/import/csv"},
+		"csv not a string": {file: "\x00\xff\xfe\x00", path: "/import/csv"},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			s, h := newTestServer(t, nil)
+			deck := strconv.FormatInt(createTestDeck(t, s), 10)
+
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			mw.WriteField("deck", deck)
+			fw, err := mw.CreateFormFile("file", "upload")
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(fw, tc.file)
+			mw.Close()
+			r := httptest.NewRequest(http.MethodPost, "/import", &body)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			resp := do(t, h, r, nil)
+			if resp.StatusCode != http.StatusSeeOther {
+				t.Fatalf("upload status %d; want %d", resp.StatusCode, http.StatusSeeOther)
+			}
+			review, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if review.Path != tc.path {
+				t.Fatalf("reviewed on %s; want %s", review.Path, tc.path)
+			}
+
+			// The review and submitting it show the error
+			resp = do(t, h, httptest.NewRequest(http.MethodGet, review.String(), nil), nil)
+			checkErrorPage(t, resp)
+			form := review.Query()
+			form.Set("conflict", "keep")
+			form.Set("front", "0")
+			form.Set("back", "1")
+			resp = do(t, h, postForm(review.Path, form), nil)
+			checkErrorPage(t, resp)
+		})
+	}
+}
+
+func checkErrorPage(t *testing.T, resp *http.Response) {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(b), "alert-danger") {
+		t.Fatalf("status %d, page:\n%s\nwant an error", resp.StatusCode, b)
+	}
+}
@@ -0,0 +1,63 @@
+// Command fetchstatic downloads third-party static assets into a directory so
+// they can be embedded, verifying each against its subresource integrity hash.
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var assets = []struct {
+	url       string
+	integrity string
+}{
+	{
+		url:       "https://cdn.jsdelivr.net/npm/bootstrap@5.2.0-beta1/dist/css/bootstrap.min.css",
+		integrity: "sha384-0evHe/X+R7YkIZDRvuzKMRqM+OrBnVFBL6DOitfPri4tjfHxaWutUpFmBp4vmVor",
+	},
+	{
+		url:       "https://cdn.jsdelivr.net/npm/bootstrap@5.2.0-beta1/dist/js/bootstrap.bundle.min.js",
+		integrity: "sha384-pprn3073KE6tl6bjs2QrFaJGz5/SUsLqktiwsUTF55Jfv3qYSDhgCecCxMW52nD2",
+	},
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: fetchstatic dir")
+	}
+	dir := os.Args[1]
+
+	for _, a := range assets {
+		if err := fetch(dir, a.url, a.integrity); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func fetch(dir, url, integrity string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	sum := sha512.Sum384(content)
+	if got := "sha384-" + base64.StdEncoding.EncodeToString(sum[:]); got != integrity {
+		return fmt.Errorf("%s: integrity %s, want %s", url, got, integrity)
+	}
+
+	return os.WriteFile(filepath.Join(dir, filepath.Base(url)), content, 0644)
+}
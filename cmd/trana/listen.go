@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type listenConfig struct {
+	// TCP address, ignored when Unix is set
+	Addr string `json:"addr"`
+
+	// Unix domain socket path and permissions
+	Unix     string   `json:"unix,omitempty"`
+	UnixMode fileMode `json:"unix_mode"`
+
+	// TLS certificate and key, reloaded when changed on disk
+	TLSCert string `json:"tls_cert,omitempty"`
+	TLSKey  string `json:"tls_key,omitempty"`
+}
+
+// fileMode is an octal file mode usable as a flag.
+type fileMode fs.FileMode
+
+func (m fileMode) String() string {
+	return fmt.Sprintf("%#o", fs.FileMode(m).Perm())
+}
+
+func (m *fileMode) Set(s string) error {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid file mode %q", s)
+	}
+	if fs.FileMode(v)&^fs.ModePerm != 0 {
+		return fmt.Errorf("file mode %q has bits outside of permissions", s)
+	}
+	*m = fileMode(v)
+	return nil
+}
+
+func (m fileMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *fileMode) UnmarshalText(text []byte) error {
+	return m.Set(string(text))
+}
+
+func (c *listenConfig) TLS() bool {
+	return c.TLSCert != "" || c.TLSKey != ""
+}
+
+func listen(c *listenConfig) (net.Listener, error) {
+	if c.Unix == "" {
+		return net.Listen("tcp", c.Addr)
+	}
+
+	// Remove a stale socket left behind by an unclean exit, but never
+	// anything else.
+	if fi, err := os.Lstat(c.Unix); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", c.Unix)
+		}
+		if err = os.Remove(c.Unix); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", c.Unix)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(c.Unix, fs.FileMode(c.UnixMode)); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func serve(srv *http.Server, c *listenConfig) error {
+	l, err := listen(c)
+	if err != nil {
+		return err
+	}
+
+	if !c.TLS() {
+		log.Printf("listening on %s", l.Addr())
+		return srv.Serve(l)
+	}
+
+	if c.TLSCert == "" || c.TLSKey == "" {
+		l.Close()
+		return errors.New("TLS requires both a certificate and a key")
+	}
+	certs := &certReloader{
+		certFile: c.TLSCert,
+		keyFile:  c.TLSKey,
+	}
+	if _, err = certs.GetCertificate(nil); err != nil {
+		l.Close()
+		return err
+	}
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	log.Printf("listening on %s (TLS)", l.Addr())
+	return srv.ServeTLS(l, "", "")
+}
+
+// certReloader loads a TLS certificate and key, and loads them again whenever
+// either file is modified so certificates can be renewed without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	certMod, err := modTime(c.certFile)
+	if err != nil {
+		return c.fallback(err)
+	}
+	keyMod, err := modTime(c.keyFile)
+	if err != nil {
+		return c.fallback(err)
+	}
+	if c.cert != nil && certMod.Equal(c.certMod) && keyMod.Equal(c.keyMod) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return c.fallback(err)
+	}
+	if c.cert != nil {
+		log.Printf("reloaded TLS certificate %s", c.certFile)
+	}
+	c.cert = &cert
+	c.certMod = certMod
+	c.keyMod = keyMod
+	return c.cert, nil
+}
+
+// fallback keeps serving the previous certificate when a reload fails, for
+// example while the certificate and key are being replaced.
+func (c *certReloader) fallback(err error) (*tls.Certificate, error) {
+	if c.cert == nil {
+		return nil, err
+	}
+	log.Printf("reloading TLS certificate: %v", err)
+	return c.cert, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
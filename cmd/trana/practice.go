@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/esote/trana"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[41m"
+	ansiGreen = "\x1b[32m"
+)
+
+// terminal practices cards interactively, mirroring the practice and check
+// pages of the web interface.
+type terminal struct {
+	in    *bufio.Reader
+	out   io.Writer
+	color bool
+}
+
+func (t *terminal) style(s, style string) string {
+	if !t.color {
+		return s
+	}
+	return style + s + ansiReset
+}
+
+// readLine returns io.EOF when input ends, so the session ends cleanly.
+func (t *terminal) readLine() (string, error) {
+	line, err := t.in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runPractice(dir string, cfg *config, args []string) error {
+	var mode PracticeMode
+	c := &command{
+		flags: flag.NewFlagSet("practice", flag.ExitOnError),
+		nargs: 1,
+		run: func(ctx context.Context, t *trana.Trana, c *command, args []string) error {
+			deck, err := findDeck(ctx, t, args[0])
+			if err != nil {
+				return err
+			}
+			settings, err := t.GetDeckSettings(ctx, deck.ID)
+			if err != nil {
+				return err
+			}
+			// The direction of the deck applies unless given as a flag
+			set := false
+			c.flags.Visit(func(f *flag.Flag) {
+				set = set || f.Name == "reverse" || f.Name == "random"
+			})
+			if !set && settings.Direction != "" {
+				mode.Reverse = settings.Direction == trana.DirectionReverse
+				mode.Random = settings.Direction == trana.DirectionRandom
+			}
+			matching := &cfg.Matching
+			if settings.Matching != nil {
+				matching = settings.Matching
+			}
+			term := &terminal{
+				in:    bufio.NewReader(os.Stdin),
+				out:   os.Stdout,
+				color: isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "",
+			}
+			err = term.practice(ctx, t, deck, mode, matching)
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(term.out)
+				return nil
+			}
+			return err
+		},
+	}
+	c.flags.BoolVar(&mode.Reverse, "reverse", cfg.PracticeMode == "reverse", "practice back to front")
+	c.flags.BoolVar(&mode.Random, "random", cfg.PracticeMode == "random", "practice in random direction")
+	return runCommand(dir, cfg, c, args)
+}
+
+func (term *terminal) practice(ctx context.Context, t *trana.Trana, deck *trana.Deck, mode PracticeMode, m *trana.Matching) error {
+	fmt.Fprintf(term.out, "Practicing %s, press Ctrl-D to quit\n", term.style(deck.Name, ansiBold))
+	for {
+		card, err := t.NextCard(ctx, deck.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("deck %s has no cards left to practice", deck.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		counts, err := t.PracticeCounts(ctx, deck.ID)
+		if err != nil {
+			return err
+		}
+
+		mode := mode
+		mode.Swapped = false
+		mode.choose(card)
+
+		fmt.Fprintf(term.out, "\n%d new, %d learning, %d review", counts.New, counts.Learning, counts.Review)
+
+		fmt.Fprintf(term.out, "\n%s\n> ", term.style(card.Front, ansiBold))
+		shown := time.Now()
+		answer, err := term.readLine()
+		if err != nil {
+			return err
+		}
+		review := trana.ReviewOptions{Duration: time.Since(shown)}
+
+		ok, diff := m.Check(answer, card.Back, '_')
+		review.Correct = &ok
+		fmt.Fprint(term.out, "You entered ")
+		for _, d := range diff {
+			if d.Ok {
+				fmt.Fprint(term.out, d.R)
+			} else if term.color {
+				fmt.Fprint(term.out, term.style(d.R, ansiRed))
+			} else {
+				fmt.Fprintf(term.out, "[%s]", d.R)
+			}
+		}
+		if ok {
+			fmt.Fprintln(term.out, term.style(" (correct)", ansiGreen))
+		} else {
+			fmt.Fprintln(term.out, " (incorrect)")
+			fmt.Fprintf(term.out, "Correct value: %s\n", term.style(card.Back, ansiGreen))
+		}
+
+		comfort, err := term.readComfort()
+		if err != nil {
+			return err
+		}
+		if comfort == 0 {
+			return nil
+		}
+		if _, err = t.ReviewCard(ctx, card.ID, comfort, &review); err != nil {
+			return err
+		}
+	}
+}
+
+// readComfort returns 0 if the user quits.
+func (term *terminal) readComfort() (float64, error) {
+	for {
+		fmt.Fprint(term.out, "1 not sure, 2 learning, 3 confident, q quit: ")
+		line, err := term.readLine()
+		if err != nil {
+			return 0, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "q" {
+			return 0, nil
+		}
+		comfort, err := strconv.Atoi(line)
+		if err == nil && comfort >= trana.ComfortReviewMin && comfort <= trana.ComfortReviewMax {
+			return float64(comfort), nil
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
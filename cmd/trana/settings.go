@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/esote/trana"
+)
+
+// direction is the default practice mode of a deck.
+func (s *server) direction(settings *trana.DeckSettings) string {
+	if settings.Direction != "" {
+		return string(settings.Direction)
+	}
+	return s.config.PracticeMode
+}
+
+// matching is the answer matching of a deck.
+func (s *server) matching(settings *trana.DeckSettings) *trana.Matching {
+	if settings.Matching != nil {
+		return settings.Matching
+	}
+	return &s.config.Matching
+}
+
+// parseSettings reads the fields of deck settings from a form.
+func parseSettings(form url.Values) (*trana.DeckSettings, error) {
+	settings := trana.DeckSettings{
+		Name:      form.Get("name"),
+		Scheduler: trana.Scheduler(form.Get("scheduler")),
+		Direction: trana.Direction(form.Get("direction")),
+		Order:     trana.Order(form.Get("order")),
+	}
+	var err error
+	if settings.NewLimit, err = strconv.Atoi(form.Get("new_limit")); err != nil || settings.NewLimit < 0 {
+		return nil, errors.New("new card limit must be a number, 0 for no limit")
+	}
+	if settings.ReviewLimit, err = strconv.Atoi(form.Get("review_limit")); err != nil || settings.ReviewLimit < 0 {
+		return nil, errors.New("review limit must be a number, 0 for no limit")
+	}
+	if form.Get("custom_matching") == "true" {
+		settings.Matching = &trana.Matching{
+			CaseSensitive:     form.Get("case_sensitive") == "true",
+			IgnoreWhitespace:  form.Get("ignore_whitespace") == "true",
+			IgnorePunctuation: form.Get("ignore_punctuation") == "true",
+			IgnoreDiacritics:  form.Get("ignore_diacritics") == "true",
+		}
+	}
+	return &settings, nil
+}
+
+// DeckSettingsSubmit saves the settings of a deck, changing them for all decks
+// which share them, or saves them as new settings used by the deck alone.
+func (s *server) DeckSettingsSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	deck, err := strconv.ParseInt(r.Form.Get("deck"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	settings, err := parseSettings(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, err := s.trana.GetDeckSettings(r.Context(), deck)
+	if err != nil {
+		log.Fatal(err)
+	}
+	settings.ID = before.ID
+	create := r.Form.Get("action") == "new"
+
+	presets, err := s.trana.ListDeckSettings(r.Context())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range presets {
+		if p.Name == settings.Name && (create || p.ID != settings.ID) {
+			http.Error(w, fmt.Sprintf("settings named %q already exist", settings.Name), http.StatusConflict)
+			return
+		}
+	}
+
+	if create {
+		id, err := s.trana.CreateDeckSettings(r.Context(), settings)
+		if errors.Is(err, trana.ErrBadSettings) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = s.trana.UseDeckSettings(r.Context(), deck, id); err != nil {
+			log.Fatal(err)
+		}
+		s.undos.push(w, r, "Created settings "+settings.Name, func(ctx context.Context, t *trana.Trana) error {
+			return t.UseDeckSettings(ctx, deck, before.ID)
+		})
+	} else {
+		err = s.trana.UpdateDeckSettings(r.Context(), settings)
+		if errors.Is(err, trana.ErrBadSettings) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "settings not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.undos.push(w, r, "Changed settings "+before.Name, func(ctx context.Context, t *trana.Trana) error {
+			return t.UpdateDeckSettings(ctx, before)
+		})
+	}
+
+	url := url.URL{
+		Path: "/deck/update",
+	}
+	query := url.Query()
+	query.Add("deck", strconv.FormatInt(deck, 10))
+	url.RawQuery = query.Encode()
+
+	http.Redirect(w, r, url.String(), http.StatusSeeOther)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:generate go run ./internal/fetchstatic static
+
+//go:embed static
+var staticFiles embed.FS
+
+// vendoredAssets are third-party files fetched into static/ with go generate,
+// which pages need to be styled and interactive.
+var vendoredAssets = []string{"bootstrap.min.css", "bootstrap.bundle.min.js"}
+
+type asset struct {
+	URL       string
+	Integrity string
+}
+
+type staticFile struct {
+	name    string
+	content []byte
+	etag    string
+}
+
+// staticAssets serves the embedded static files. Each file is also available
+// under a name containing a hash of its content, which is cached forever.
+type staticAssets struct {
+	// Content-hashed name to file
+	files map[string]*staticFile
+
+	// Original name to asset
+	assets map[string]asset
+}
+
+const staticPrefix = "/static/"
+
+func loadStatic() (*staticAssets, error) {
+	s := &staticAssets{
+		files:  make(map[string]*staticFile),
+		assets: make(map[string]asset),
+	}
+	entries, err := fs.ReadDir(staticFiles, "static")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		content, err := fs.ReadFile(staticFiles, path.Join("static", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:6])
+		ext := path.Ext(e.Name())
+		hashed := strings.TrimSuffix(e.Name(), ext) + "." + hash + ext
+
+		f := &staticFile{
+			name:    e.Name(),
+			content: content,
+			etag:    `"` + hash + `"`,
+		}
+		s.files[hashed] = f
+		s.files[e.Name()] = f
+
+		integrity := sha512.Sum384(content)
+		s.assets[e.Name()] = asset{
+			URL:       staticPrefix + hashed,
+			Integrity: "sha384-" + base64.StdEncoding.EncodeToString(integrity[:]),
+		}
+	}
+
+	for _, name := range vendoredAssets {
+		if _, ok := s.assets[name]; !ok {
+			return nil, fmt.Errorf("static asset %s is missing, run go generate ./cmd/trana", name)
+		}
+	}
+	return s, nil
+}
+
+// Asset returns where the static file name is served from, for templates, or
+// nil if it is not embedded.
+func (s *staticAssets) Asset(name string) *asset {
+	a, ok := s.assets[name]
+	if !ok {
+		return nil
+	}
+	return &a
+}
+
+func (s *staticAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "*")
+	f, ok := s.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == f.name {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	if ctype := mime.TypeByExtension(path.Ext(f.name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("ETag", f.etag)
+	http.ServeContent(w, r, f.name, time.Time{}, bytes.NewReader(f.content))
+}
+
+// mediaFiles serves the files of the media directory, without listing its
+// directories.
+func mediaFiles(dir string) http.Handler {
+	return http.FileServer(filesOnly{http.Dir(dir)})
+}
+
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
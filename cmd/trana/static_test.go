@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMediaFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"hund.png", filepath.Join("sub", "katt.png")} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("png"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testcases := map[string]int{
+		"/":             http.StatusNotFound,
+		"/sub/":         http.StatusNotFound,
+		"/sub":          http.StatusNotFound,
+		"/hund.png":     http.StatusOK,
+		"/sub/katt.png": http.StatusOK,
+		"/ko.png":       http.StatusNotFound,
+	}
+
+	h := mediaFiles(dir)
+	for target, want := range testcases {
+		t.Run(target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			if w.Code != want {
+				t.Fatalf("status %d; want %d", w.Code, want)
+			}
+		})
+	}
+}
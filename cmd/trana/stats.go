@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/esote/trana"
+)
+
+// barChart is an SVG bar chart, laid out in Go so that pages need no
+// JavaScript.
+type barChart struct {
+	Width, Height float64
+	Bars          []chartBar
+
+	// Label of the largest value, at the top left
+	Max string
+}
+
+type chartBar struct {
+	X, Y, Width, Height float64
+
+	// Horizontal center of the bar
+	Center float64
+
+	// Label below the bar, may be empty
+	Label string
+
+	// Shown when hovering the bar
+	Title string
+}
+
+const (
+	chartHeight = 100
+	chartLabels = 14
+)
+
+// newBarChart lays out a bar of width per value, scaled to at least max.
+// Values below 0 have no bar.
+func newBarChart(values []float64, labels, titles []string, max float64, width int) *barChart {
+	c := &barChart{
+		Width:  float64(len(values) * width),
+		Height: chartHeight + chartLabels,
+		Max:    strconv.FormatFloat(max, 'f', -1, 64),
+	}
+	for _, v := range values {
+		if v > max {
+			max = v
+			c.Max = strconv.FormatFloat(max, 'f', -1, 64)
+		}
+	}
+	for i, v := range values {
+		bar := chartBar{
+			X:      float64(i*width) + 2,
+			Y:      chartHeight,
+			Width:  float64(width) - 4,
+			Center: float64(i*width) + float64(width)/2,
+			Label:  labels[i],
+			Title:  titles[i],
+		}
+		if v > 0 && max > 0 {
+			bar.Height = v / max * chartHeight
+			bar.Y -= bar.Height
+		}
+		c.Bars = append(c.Bars, bar)
+	}
+	return c
+}
+
+type Stats struct {
+	// Nil for all decks
+	Deck  *trana.Deck
+	Stats *trana.Stats
+
+	AverageDuration string
+
+	Comfort, Reviews, Accuracy, Forecast *barChart
+}
+
+func (s *server) Stats(w http.ResponseWriter, r *http.Request) {
+	var page Stats
+	var deck int64
+	if v := r.URL.Query().Get("deck"); v != "" {
+		var err error
+		if deck, err = strconv.ParseInt(v, 10, 64); err != nil {
+			log.Fatal(err)
+		}
+		if page.Deck, err = s.trana.GetDeck(r.Context(), deck); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	stats, err := s.trana.Stats(r.Context(), deck)
+	if err != nil {
+		log.Fatal(err)
+	}
+	page.Stats = stats
+	if stats.AverageDuration > 0 {
+		page.AverageDuration = stats.AverageDuration.Round(100 * time.Millisecond).String()
+	}
+
+	var values []float64
+	var labels, titles []string
+	for _, b := range stats.Comfort {
+		values = append(values, float64(b.Cards))
+		labels = append(labels, b.Label)
+		titles = append(titles, fmt.Sprintf("%s: %d cards", b.Label, b.Cards))
+	}
+	page.Comfort = newBarChart(values, labels, titles, 1, 60)
+
+	values, labels, titles = nil, nil, nil
+	var accuracy []float64
+	var accuracyTitles []string
+	for i, d := range stats.Days {
+		date := d.Date.Format("Jan 2")
+		label := ""
+		if i%7 == len(stats.Days)%7 {
+			label = d.Date.Format("2")
+		}
+		values = append(values, float64(d.Reviews))
+		labels = append(labels, label)
+		titles = append(titles, fmt.Sprintf("%s: %d reviews", date, d.Reviews))
+
+		a := d.Accuracy()
+		title := date + ": no checked answers"
+		if a >= 0 {
+			a *= 100
+			title = fmt.Sprintf("%s: %.0f%% of %d answers correct", date, a, d.Checked)
+		}
+		accuracy = append(accuracy, a)
+		accuracyTitles = append(accuracyTitles, title)
+	}
+	page.Reviews = newBarChart(values, labels, titles, 1, 20)
+	page.Accuracy = newBarChart(accuracy, labels, accuracyTitles, 100, 20)
+
+	values, labels, titles = nil, nil, nil
+	today := stats.Days[len(stats.Days)-1].Date
+	for i, n := range stats.Forecast {
+		day := today.AddDate(0, 0, i)
+		label := ""
+		if i%7 == 0 {
+			label = day.Format("2")
+		}
+		values = append(values, float64(n))
+		labels = append(labels, label)
+		titles = append(titles, fmt.Sprintf("%s: %d cards due", day.Format("Jan 2"), n))
+	}
+	page.Forecast = newBarChart(values, labels, titles, 1, 20)
+
+	if err = s.template("stats", w, r, &page); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// heatmap is an SVG calendar of reviews per day with a column per week,
+// shaded by progress towards the daily goal.
+type heatmap struct {
+	Width, Height float64
+	Size          float64
+	Cells         []heatmapCell
+
+	// Month labels above the first week of each month, and weekday labels
+	Labels []heatmapLabel
+}
+
+type heatmapCell struct {
+	X, Y float64
+
+	// From 0 for no reviews to 4 for at least twice the goal. The goal is
+	// met from 3.
+	Level int
+
+	// Shown when hovering the cell
+	Title string
+}
+
+type heatmapLabel struct {
+	X, Y  float64
+	Label string
+}
+
+const (
+	heatmapSize = 10
+	heatmapStep = heatmapSize + 2
+
+	// Space for the labels
+	heatmapLeft = 22
+	heatmapTop  = 10
+)
+
+func newHeatmap(a *trana.Activity) *heatmap {
+	weeks := (len(a.Days) + 6) / 7
+	h := &heatmap{
+		Width:  float64(heatmapLeft + weeks*heatmapStep),
+		Height: float64(heatmapTop + 7*heatmapStep),
+		Size:   heatmapSize,
+	}
+	for _, wd := range []time.Weekday{time.Monday, time.Wednesday, time.Friday} {
+		h.Labels = append(h.Labels, heatmapLabel{
+			X:     0,
+			Y:     float64(heatmapTop + int(wd)*heatmapStep + heatmapSize),
+			Label: wd.String()[:3],
+		})
+	}
+	for i, d := range a.Days {
+		week, wd := i/7, int(d.Date.Weekday())
+		x := float64(heatmapLeft + week*heatmapStep)
+		if wd == 0 && d.Date.Day() <= 7 && week > 0 {
+			h.Labels = append(h.Labels, heatmapLabel{X: x, Y: heatmapTop - 2, Label: d.Date.Format("Jan")})
+		}
+
+		level := 0
+		switch {
+		case d.Reviews == 0:
+		case d.Reviews*2 < a.Goal:
+			level = 1
+		case d.Reviews < a.Goal:
+			level = 2
+		case d.Reviews < 2*a.Goal:
+			level = 3
+		default:
+			level = 4
+		}
+		reviews := "reviews"
+		if d.Reviews == 1 {
+			reviews = "review"
+		}
+		h.Cells = append(h.Cells, heatmapCell{
+			X:     x,
+			Y:     float64(heatmapTop + wd*heatmapStep),
+			Level: level,
+			Title: fmt.Sprintf("%s: %d %s", d.Date.Format("Mon Jan 2, 2006"), d.Reviews, reviews),
+		})
+	}
+	return h
+}
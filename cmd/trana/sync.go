@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/esote/trana"
+)
+
+// Sync answers the sync request of a peer, see trana.SyncServe.
+func (s *server) Sync(w http.ResponseWriter, r *http.Request) {
+	token := s.config.Sync.Token
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	auth := []byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if subtle.ConstantTimeCompare(auth, []byte(token)) != 1 {
+		http.Error(w, "invalid sync token", http.StatusUnauthorized)
+		return
+	}
+
+	var req trana.SyncRequest
+	d := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.config.MaxUpload))
+	if err := d.Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.trana.SyncServe(r.Context(), &req)
+	if errors.Is(err, trana.ErrBadSync) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// syncExchange sends sync requests to the instance at url.
+func syncExchange(ctx context.Context, url, token string) func(*trana.SyncRequest) (*trana.SyncResponse, error) {
+	return func(req *trana.SyncRequest) (*trana.SyncResponse, error) {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(url, "/")+"/sync", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			return nil, fmt.Errorf("sync: %s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
+
+		var sr trana.SyncResponse
+		if err = json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+			return nil, err
+		}
+		return &sr, nil
+	}
+}
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
 	"embed"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
-	"io"
 	"io/fs"
 	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/esote/configdir"
@@ -26,14 +32,22 @@ import (
 //go:embed templates/*
 var templateFiles embed.FS
 
-func loadTemplates() (map[string]*template.Template, error) {
+func loadTemplates(static *staticAssets) (map[string]*template.Template, error) {
+	funcs := template.FuncMap{
+		"asset": static.Asset,
+		"steps": trana.FormatSteps,
+	}
+
 	templates := make(map[string]*template.Template)
 	files, err := fs.ReadDir(templateFiles, "templates")
 	if err != nil {
 		return nil, err
 	}
 	for _, f := range files {
-		t, err := template.ParseFS(templateFiles, filepath.Join("templates", f.Name()), filepath.Join("templates", "layout.html"))
+		if f.IsDir() {
+			continue
+		}
+		t, err := template.New(f.Name()).Funcs(funcs).ParseFS(templateFiles, filepath.Join("templates", f.Name()), filepath.Join("templates", "layout.html"), filepath.Join("templates", "partials", "*.html"))
 		if err != nil {
 			return nil, err
 		}
@@ -43,8 +57,31 @@ func loadTemplates() (map[string]*template.Template, error) {
 }
 
 func main() {
-	var dir string
+	var dir, configFile string
 	flag.StringVar(&dir, "d", "", "alternative config directory")
+	flag.StringVar(&configFile, "c", "", "config file (default "+configName+" in config directory)")
+
+	cfg := defaultConfig()
+	flag.StringVar(&cfg.Listen.Addr, "addr", cfg.Listen.Addr, "TCP listen address")
+	flag.StringVar(&cfg.Listen.Unix, "unix", cfg.Listen.Unix, "listen on Unix domain socket instead of TCP")
+	flag.Var(&cfg.Listen.UnixMode, "unix-mode", "Unix domain socket permissions")
+	flag.StringVar(&cfg.Listen.TLSCert, "tls-cert", cfg.Listen.TLSCert, "TLS certificate file")
+	flag.StringVar(&cfg.Listen.TLSKey, "tls-key", cfg.Listen.TLSKey, "TLS key file")
+	flag.StringVar((*string)(&cfg.Scheduler), "scheduler", string(cfg.Scheduler), "default scheduler")
+	flag.StringVar(&cfg.PracticeMode, "mode", cfg.PracticeMode, "default practice mode")
+	flag.StringVar(&cfg.Log.File, "log", cfg.Log.File, "append logs to file")
+	flag.Var(&cfg.ShutdownTimeout, "shutdown-timeout", "time allowed for requests to finish on shutdown")
+	flag.Int64Var(&cfg.MaxUpload, "max-upload", cfg.MaxUpload, "largest accepted upload in bytes")
+	flag.IntVar(&cfg.DailyGoal, "goal", cfg.DailyGoal, "reviews per day which continue a streak")
+	flag.StringVar(&cfg.Timezone, "timezone", cfg.Timezone, "time zone of days in statistics (default local)")
+	flag.Var(&cfg.TrashRetention, "trash-retention", "time deleted decks and cards are kept in the trash")
+	flag.IntVar(&cfg.RepeatGap, "repeat-gap", cfg.RepeatGap, "other cards practiced before a card is repeated")
+	flag.Var(&cfg.RepeatDelay, "repeat-delay", "time before a practiced card is repeated")
+	flag.BoolVar(&cfg.BurySiblings, "bury-siblings", cfg.BurySiblings, "bury the reversed twin of a reviewed card until the next day")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if dir == "" {
@@ -55,73 +92,254 @@ func main() {
 		}
 
 	}
-	file := filepath.Join(dir, "trana.db")
+	if configFile == "" {
+		configFile = filepath.Join(dir, configName)
+	}
+	if err := loadConfig(cfg, configFile); err != nil {
+		log.Fatal(err)
+	}
 
-	deck, err := trana.New(file)
-	if err != nil {
+	// Parse again so flags override the config file
+	flag.Parse()
+
+	if err := cfg.validate(); err != nil {
 		log.Fatal(err)
 	}
-	defer deck.Close()
 
-	templates, err := loadTemplates()
+	if cfg.Log.File != "" {
+		f, err := os.OpenFile(cfg.Log.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		log.SetOutput(f)
+	}
+
+	var err error
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	switch cmd := args[0]; cmd {
+	case "serve":
+		err = runServe(dir, cfg)
+	case "config":
+		err = runConfig(cfg, args[1:])
+	case "deck":
+		err = runDeck(dir, cfg, args[1:])
+	case "card":
+		err = runCard(dir, cfg, args[1:])
+	case "practice":
+		err = runPractice(dir, cfg, args[1:])
+	case "import":
+		err = runImport(dir, cfg, args[1:])
+	case "export":
+		err = runExport(dir, cfg, args[1:])
+	case "backup":
+		err = runBackup(dir, configFile, cfg, args[1:])
+	case "restore":
+		err = runRestore(dir, configFile, cfg, args[1:])
+	case "sync":
+		err = runSync(dir, cfg, args[1:])
+	case "trash":
+		err = runTrash(dir, cfg, args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+}
+
+func runServe(dir string, cfg *config) error {
+	static, err := loadStatic()
+	if err != nil {
+		return err
+	}
+
+	templates, err := loadTemplates(static)
+	if err != nil {
+		return err
+	}
+
+	uploads, err := newUploads()
+	if err != nil {
+		return err
+	}
+	defer uploads.Close()
 
-	server := server{deck, templates}
+	deck, err := openTrana(dir, cfg)
+	if err != nil {
+		return err
+	}
+
+	server := server{
+		trana:     deck,
+		templates: templates,
+		config:    cfg,
+		uploads:   uploads,
+		undos:     newUndoStacks(),
+	}
+
+	// Requests in flight, which Close on shutdown does not wait for
+	var handling sync.WaitGroup
 
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handling.Add(1)
+			defer handling.Done()
+			next.ServeHTTP(w, r)
+		})
+	})
+	if cfg.Log.Requests {
+		r.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{
+			Logger:  log.Default(),
+			NoColor: cfg.Log.File != "",
+		}))
+	}
+
+	server.routes(r, static, mediaDir(dir))
+
+	srv := &http.Server{
+		Handler: r,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	purged := make(chan struct{})
+	go func() {
+		purgeTrash(ctx, deck)
+		close(purged)
+	}()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(srv, &cfg.Listen)
+	}()
+
+	// Requests are given until the deadline to finish
+	var deadline time.Time
+	select {
+	case err = <-served:
+		deadline = time.Now().Add(time.Duration(cfg.ShutdownTimeout))
+	case <-ctx.Done():
+		stop()
+		log.Print("shutting down")
+		deadline = time.Now().Add(time.Duration(cfg.ShutdownTimeout))
+		shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
+		if err = srv.Shutdown(shutdownCtx); err != nil {
+			// Timed out, cut off the remaining requests
+			srv.Close()
+		}
+		cancel()
+		if err2 := <-served; !errors.Is(err2, http.ErrServerClosed) && err == nil {
+			err = err2
+		}
+	}
 
-	r.Get("/", server.ListDecks)
+	stop()
+	<-purged
 
-	r.Get("/deck/create", server.CreateDeck)
-	r.Post("/deck/create", server.CreateDeckSubmit)
+	// The database is closed once no more requests are in flight, or at the
+	// deadline if some are stuck
+	finished := make(chan struct{})
+	go func() {
+		handling.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Until(deadline)):
+		log.Print("requests still in flight at the shutdown timeout")
+	}
+	if err2 := deck.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
 
-	r.Get("/deck/update", server.UpdateDeck)
-	r.Post("/deck/update", server.UpdateDeckSubmit)
+// routes adds the pages of the server to r, with media files served from the
+// directory media.
+func (s *server) routes(r chi.Router, static *staticAssets, media string) {
+	r.Get("/", s.ListDecks)
 
-	r.Get("/deck/delete", server.DeleteDeck)
-	r.Post("/deck/delete", server.DeleteDeckSubmit)
+	r.Handle(staticPrefix+"*", static)
+	r.Handle("/media/*", http.StripPrefix("/media/", mediaFiles(media)))
 
-	r.Get("/cards", server.ListCards)
+	r.Get("/deck/create", s.CreateDeck)
+	r.Post("/deck/create", s.CreateDeckSubmit)
 
-	r.Get("/card/create", server.CreateCard)
-	r.Post("/card/create", server.CreateCardSubmit)
+	r.Get("/deck/update", s.UpdateDeck)
+	r.Post("/deck/update", s.UpdateDeckSubmit)
+	r.Post("/deck/settings", s.DeckSettingsSubmit)
 
-	r.Get("/card/practice", server.PracticeCard)
-	r.Get("/card/check", server.CheckCard)
-	r.Post("/card/check", server.CheckCardSubmit)
+	r.Get("/deck/delete", s.DeleteDeck)
+	r.Post("/deck/delete", s.DeleteDeckSubmit)
 
-	r.Get("/card/update", server.UpdateCard)
-	r.Post("/card/update", server.UpdateCardSubmit)
+	r.Get("/cards", s.ListCards)
 
-	r.Get("/card/delete", server.DeleteCard)
-	r.Post("/card/delete", server.DeleteCardSubmit)
+	r.Get("/card/create", s.CreateCard)
+	r.Post("/card/create", s.CreateCardSubmit)
 
-	r.Post("/import", server.ImportCards)
-	r.Get("/export", server.ExportCards)
+	r.Get("/card/practice", s.PracticeCard)
+	r.Get("/card/check", s.CheckCard)
+	r.Post("/card/check", s.CheckCardSubmit)
 
-	if err = http.ListenAndServe(":8080", r); err != nil {
-		log.Fatal(err)
-	}
+	r.Get("/card/update", s.UpdateCard)
+	r.Post("/card/update", s.UpdateCardSubmit)
+	r.Post("/card/restore", s.RestoreCardRevision)
+
+	r.Post("/card/state", s.CardStateSubmit)
+
+	r.Get("/card/delete", s.DeleteCard)
+	r.Post("/card/delete", s.DeleteCardSubmit)
+
+	r.Post("/import", s.ImportCards)
+	r.Get("/import/"+formatAnki, s.ImportAnki)
+	r.Post("/import/"+formatAnki, s.ImportAnkiSubmit)
+	r.Get("/import/json", s.ImportJSON)
+	r.Post("/import/json", s.ImportJSONSubmit)
+	r.Get("/import/csv", s.ImportCSV)
+	r.Post("/import/csv", s.ImportCSVSubmit)
+	r.Get("/export", s.ExportCards)
+	r.Post("/sync", s.Sync)
+	r.Get("/stats", s.Stats)
+	r.Get("/trash", s.Trash)
+	r.Post("/undo", s.UndoSubmit)
+	r.Post("/trash/restore", s.RestoreTrashSubmit)
 }
 
 type server struct {
 	trana     *trana.Trana
 	templates map[string]*template.Template
+	config    *config
+	uploads   *uploads
+	undos     *undoStacks
 }
 
-func (s *server) template(name string, w io.Writer, page any) error {
-	return s.templates[name+".html"].ExecuteTemplate(w, "layout", page)
+// layoutPage is the page of a template with what the layout adds to it.
+type layoutPage struct {
+	Page any
+	Undo *undoToast
+}
+
+func (s *server) template(name string, w http.ResponseWriter, r *http.Request, page any) error {
+	return s.templates[name+".html"].ExecuteTemplate(w, "layout", &layoutPage{
+		Page: page,
+		Undo: s.undos.toast(w, r),
+	})
 }
 
 type ListDecks struct {
-	Decks []trana.Deck
+	Decks    []trana.Deck
+	Activity *trana.Activity
+	Heatmap  *heatmap
 }
 
 func (s *server) CreateDeck(w http.ResponseWriter, r *http.Request) {
-	if err := s.template("deck_create", w, nil); err != nil {
+	if err := s.template("deck_create", w, r, nil); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -133,7 +351,7 @@ func (s *server) CreateDeckSubmit(w http.ResponseWriter, r *http.Request) {
 
 	name := r.Form.Get("name")
 
-	if err := s.trana.CreateDeck(r.Context(), name); err != nil {
+	if _, err := s.trana.CreateDeck(r.Context(), name); err != nil {
 		log.Fatal(err)
 	}
 
@@ -142,6 +360,14 @@ func (s *server) CreateDeckSubmit(w http.ResponseWriter, r *http.Request) {
 
 type UpdateDeck struct {
 	Deck *trana.Deck
+
+	// Settings of the deck, and all settings it may use instead
+	Settings *trana.DeckSettings
+	Presets  []trana.DeckSettings
+
+	// Instance defaults of settings left empty
+	Scheduler trana.Scheduler
+	Mode      string
 }
 
 func (s *server) UpdateDeck(w http.ResponseWriter, r *http.Request) {
@@ -150,14 +376,27 @@ func (s *server) UpdateDeck(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	var page UpdateDeck
+	page := UpdateDeck{
+		Scheduler: s.config.Scheduler,
+		Mode:      s.config.PracticeMode,
+	}
 
 	page.Deck, err = s.trana.GetDeck(r.Context(), deck)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err = s.template("deck_update", w, &page); err != nil {
+	page.Settings, err = s.trana.GetDeckSettings(r.Context(), deck)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	page.Presets, err = s.trana.ListDeckSettings(r.Context())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = s.template("deck_update", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -177,9 +416,50 @@ func (s *server) UpdateDeckSubmit(w http.ResponseWriter, r *http.Request) {
 
 	deck.Name = r.Form.Get("name")
 
+	deck.LearningSteps, err = trana.ParseSteps(r.Form.Get("learning_steps"))
+	if err != nil {
+		http.Error(w, "learning steps: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	deck.RelearningSteps, err = trana.ParseSteps(r.Form.Get("relearning_steps"))
+	if err != nil {
+		http.Error(w, "relearning steps: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := strconv.ParseInt(r.Form.Get("settings"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	before, err := s.trana.GetDeck(r.Context(), deck.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	beforeSettings, err := s.trana.GetDeckSettings(r.Context(), deck.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if err = s.trana.UpdateDeck(r.Context(), &deck); err != nil {
 		log.Fatal(err)
 	}
+	if err = s.trana.SetLearningSteps(r.Context(), deck.ID, deck.LearningSteps, deck.RelearningSteps); err != nil {
+		log.Fatal(err)
+	}
+	if err = s.trana.UseDeckSettings(r.Context(), deck.ID, settings); err != nil {
+		log.Fatal(err)
+	}
+
+	s.undos.push(w, r, "Updated "+before.Name, func(ctx context.Context, t *trana.Trana) error {
+		if err := t.UpdateDeck(ctx, before); err != nil {
+			return err
+		}
+		if err := t.SetLearningSteps(ctx, before.ID, before.LearningSteps, before.RelearningSteps); err != nil {
+			return err
+		}
+		return t.UseDeckSettings(ctx, before.ID, beforeSettings.ID)
+	})
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -201,7 +481,7 @@ func (s *server) DeleteDeck(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.template("deck_delete", w, &page); err != nil {
+	if err = s.template("deck_delete", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -216,10 +496,24 @@ func (s *server) DeleteDeckSubmit(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.trana.DeleteDeck(r.Context(), deck); err != nil {
+	before, err := s.trana.GetDeck(r.Context(), deck)
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	err = s.trana.DeleteDeck(r.Context(), deck)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "deck not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.undos.push(w, r, "Deleted "+before.Name, func(ctx context.Context, t *trana.Trana) error {
+		return t.RestoreDeck(ctx, deck)
+	})
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -232,7 +526,13 @@ func (s *server) ListDecks(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.template("decks", w, &page); err != nil {
+	page.Activity, err = s.trana.Activity(r.Context(), s.config.DailyGoal)
+	if err != nil {
+		log.Fatal(err)
+	}
+	page.Heatmap = newHeatmap(page.Activity)
+
+	if err = s.template("decks", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -254,7 +554,7 @@ func (s *server) CreateCard(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.template("card_create", w, &page); err != nil {
+	if err = s.template("card_create", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -272,7 +572,7 @@ func (s *server) CreateCardSubmit(w http.ResponseWriter, r *http.Request) {
 	front := r.Form.Get("front")
 	back := r.Form.Get("back")
 
-	if err = s.trana.CreateCard(r.Context(), deck, front, back); err != nil {
+	if _, err = s.trana.CreateCard(r.Context(), deck, front, back); err != nil {
 		log.Fatal(err)
 	}
 
@@ -295,6 +595,14 @@ type PracticeMode struct {
 	Random  bool
 }
 
+// choose decides whether to swap the next card, and swaps it.
+func (m *PracticeMode) choose(card *trana.Card) {
+	if m.Reverse || (m.Random && rand.Intn(2) == 0) {
+		m.Swapped = true
+		card.Front, card.Back = card.Back, card.Front
+	}
+}
+
 func getMode(v url.Values) PracticeMode {
 	return PracticeMode{
 		Swapped: v.Get("swapped") == "true",
@@ -304,9 +612,13 @@ func getMode(v url.Values) PracticeMode {
 }
 
 type PracticeCard struct {
-	Deck *trana.Deck
-	Card *trana.Card
-	Mode PracticeMode
+	Deck   *trana.Deck
+	Card   *trana.Card
+	Mode   PracticeMode
+	Counts *trana.PracticeCounts
+
+	// When the card was shown, in Unix milliseconds, to time the answer
+	Shown int64
 }
 
 func (s *server) PracticeCard(w http.ResponseWriter, r *http.Request) {
@@ -322,43 +634,26 @@ func (s *server) PracticeCard(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
+	// No card is left when the deck is done for today
 	page.Card, err = s.trana.NextCard(r.Context(), deck)
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Fatal(err)
 	}
 
-	page.Mode = getMode(r.URL.Query())
-	if page.Mode.Reverse || (page.Mode.Random && rand.Intn(2) == 0) {
-		page.Mode.Swapped = true
-		page.Card.Front, page.Card.Back = page.Card.Back, page.Card.Front
-	}
-
-	if err = s.template("card_practice", w, &page); err != nil {
+	page.Counts, err = s.trana.PracticeCounts(r.Context(), deck)
+	if err != nil {
 		log.Fatal(err)
 	}
-}
-
-type LetterDiff struct {
-	R  string
-	Ok bool
-}
 
-func unicodeDiff(got, want string, fill rune) []LetterDiff {
-	var diff []LetterDiff
-	gotRunes := []rune(got)
-	wantRunes := []rune(want)
-
-	for len(gotRunes) < len(wantRunes) {
-		gotRunes = append(gotRunes, fill)
+	page.Mode = getMode(r.URL.Query())
+	if page.Card != nil {
+		page.Mode.choose(page.Card)
 	}
+	page.Shown = time.Now().UnixMilli()
 
-	for i := range gotRunes {
-		diff = append(diff, LetterDiff{
-			R:  string(gotRunes[i]),
-			Ok: i < len(wantRunes) && strings.EqualFold(string(gotRunes[i]), string(wantRunes[i])),
-		})
+	if err = s.template("card_practice", w, r, &page); err != nil {
+		log.Fatal(err)
 	}
-	return diff
 }
 
 type CheckCard struct {
@@ -367,7 +662,10 @@ type CheckCard struct {
 	Mode PracticeMode
 
 	Ok   bool
-	Diff []LetterDiff
+	Diff []trana.LetterDiff
+
+	// Milliseconds taken to answer, 0 if unknown
+	Duration int64
 }
 
 func (s *server) CheckCard(w http.ResponseWriter, r *http.Request) {
@@ -398,12 +696,19 @@ func (s *server) CheckCard(w http.ResponseWriter, r *http.Request) {
 		page.Card.Front, page.Card.Back = page.Card.Back, page.Card.Front
 	}
 
-	page.Ok = strings.EqualFold(back, page.Card.Back)
+	settings, err := s.trana.GetDeckSettings(r.Context(), deck)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	const figureSpace = '\u2007'
-	page.Diff = unicodeDiff(back, page.Card.Back, figureSpace)
+	page.Ok, page.Diff = s.matching(settings).Check(back, page.Card.Back, figureSpace)
+
+	if shown, err := strconv.ParseInt(r.URL.Query().Get("shown"), 10, 64); err == nil {
+		page.Duration = time.Now().UnixMilli() - shown
+	}
 
-	if err = s.template("card_check", w, &page); err != nil {
+	if err = s.template("card_check", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -425,10 +730,29 @@ func (s *server) CheckCardSubmit(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.trana.ReviewCard(r.Context(), card, comfort); err != nil {
+	// Set by the check page
+	var review trana.ReviewOptions
+	if correct, err := strconv.ParseBool(r.Form.Get("correct")); err == nil {
+		review.Correct = &correct
+	}
+	if duration, err := strconv.ParseInt(r.Form.Get("duration"), 10, 64); err == nil {
+		review.Duration = time.Duration(duration) * time.Millisecond
+	}
+
+	before, err := s.trana.GetCard(r.Context(), card)
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	reviewed, err := s.trana.ReviewCard(r.Context(), card, comfort, &review)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.undos.push(w, r, "Reviewed "+before.Front, func(ctx context.Context, t *trana.Trana) error {
+		return t.UndoReview(ctx, reviewed, before)
+	})
+
 	mode := getMode(r.Form)
 	url := url.URL{
 		Path: "/card/practice",
@@ -450,10 +774,23 @@ type UpdateCard struct {
 	Deck *trana.Deck
 	Card *trana.Card
 
+	// Newest first
+	Revisions []trana.Revision
+	Sources   map[trana.RevisionSource]string
+
 	TimeFormat             string
 	ComfortMin, ComfortMax float64
 }
 
+// revisionSources describe the sources of revisions in the card history.
+var revisionSources = map[trana.RevisionSource]string{
+	trana.RevisionUI:      "Edited",
+	trana.RevisionAPI:     "Edited from the command line",
+	trana.RevisionImport:  "Imported",
+	trana.RevisionSync:    "Synced",
+	trana.RevisionRestore: "Restored",
+}
+
 const dateTimeLocal = "2006-01-02T15:04"
 
 func (s *server) UpdateCard(w http.ResponseWriter, r *http.Request) {
@@ -468,6 +805,7 @@ func (s *server) UpdateCard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	page := UpdateCard{
+		Sources:    revisionSources,
 		TimeFormat: dateTimeLocal,
 		ComfortMin: trana.ComfortMin,
 		ComfortMax: trana.ComfortMax,
@@ -483,11 +821,46 @@ func (s *server) UpdateCard(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.template("card_update", w, &page); err != nil {
+	page.Revisions, err = s.trana.CardRevisions(r.Context(), card)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = s.template("card_update", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
 
+func (s *server) RestoreCardRevision(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	revision, err := strconv.ParseInt(r.Form.Get("revision"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = s.trana.RestoreCardRevision(r.Context(), revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	url := url.URL{
+		Path: "/card/update",
+	}
+	query := url.Query()
+	query.Add("deck", r.Form.Get("deck"))
+	query.Add("card", r.Form.Get("card"))
+	url.RawQuery = query.Encode()
+
+	http.Redirect(w, r, url.String(), http.StatusSeeOther)
+}
+
 func (s *server) UpdateCardSubmit(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		log.Fatal(err)
@@ -503,6 +876,7 @@ func (s *server) UpdateCardSubmit(w http.ResponseWriter, r *http.Request) {
 
 	card.Front = r.Form.Get("front")
 	card.Back = r.Form.Get("back")
+	card.Tags = strings.Fields(r.Form.Get("tags"))
 
 	if r.Form.Get("last_practiced") != "" {
 		t, err := time.ParseInLocation(dateTimeLocal, r.Form.Get("last_practiced"), time.Local)
@@ -522,7 +896,59 @@ func (s *server) UpdateCardSubmit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err = s.trana.UpdateCard(r.Context(), &card); err != nil {
+	before, err := s.trana.GetCard(r.Context(), card.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = s.trana.UpdateCard(r.Context(), &card, trana.RevisionUI); err != nil {
+		log.Fatal(err)
+	}
+
+	// Reviews since the edit are kept
+	s.undos.push(w, r, "Edited "+before.Front, func(ctx context.Context, t *trana.Trana) error {
+		return t.UpdateCardContent(ctx, before, trana.RevisionUI)
+	})
+
+	url := url.URL{
+		Path: "/cards",
+	}
+	query := url.Query()
+	query.Add("deck", r.Form.Get("deck"))
+	url.RawQuery = query.Encode()
+
+	http.Redirect(w, r, url.String(), http.StatusSeeOther)
+}
+
+// CardStateSubmit suspends, unsuspends, buries or unburies a card.
+func (s *server) CardStateSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	card, err := strconv.ParseInt(r.Form.Get("card"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch r.Form.Get("state") {
+	case "suspend":
+		err = s.trana.SuspendCard(r.Context(), card)
+	case "unsuspend":
+		err = s.trana.UnsuspendCard(r.Context(), card)
+	case "bury":
+		err = s.trana.BuryCard(r.Context(), card)
+	case "unbury":
+		err = s.trana.UnburyCard(r.Context(), card)
+	default:
+		http.Error(w, "unknown state", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "card not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 
@@ -564,7 +990,7 @@ func (s *server) DeleteCard(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.template("card_delete", w, &page); err != nil {
+	if err = s.template("card_delete", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -579,10 +1005,24 @@ func (s *server) DeleteCardSubmit(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	if err = s.trana.DeleteCard(r.Context(), card); err != nil {
+	before, err := s.trana.GetCard(r.Context(), card)
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	err = s.trana.DeleteCard(r.Context(), card)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "card not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.undos.push(w, r, "Deleted "+before.Front, func(ctx context.Context, t *trana.Trana) error {
+		return t.RestoreCard(ctx, card)
+	})
+
 	url := url.URL{
 		Path: "/cards",
 	}
@@ -596,6 +1036,9 @@ func (s *server) DeleteCardSubmit(w http.ResponseWriter, r *http.Request) {
 type ListCards struct {
 	Deck  *trana.Deck
 	Cards []trana.Card
+
+	// Default practice mode
+	Mode string
 }
 
 func (s *server) ListCards(w http.ResponseWriter, r *http.Request) {
@@ -611,64 +1054,92 @@ func (s *server) ListCards(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
+	settings, err := s.trana.GetDeckSettings(r.Context(), deck)
+	if err != nil {
+		log.Fatal(err)
+	}
+	page.Mode = s.direction(settings)
+
 	page.Cards, err = s.trana.ListCards(r.Context(), deck)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err = s.template("cards", w, &page); err != nil {
+	if err = s.template("cards", w, r, &page); err != nil {
 		log.Fatal(err)
 	}
 }
 
 func (s *server) ImportCards(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > s.config.MaxUpload {
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUpload)
+
 	file, _, err := r.FormFile("file")
 	if err != nil {
-		log.Fatal(err)
+		// Too large, or not a form with a file
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 	defer file.Close()
 
-	deck, err := strconv.ParseInt(r.Form.Get("deck"), 10, 64)
-	if err != nil {
+	if _, err = strconv.ParseInt(r.Form.Get("deck"), 10, 64); err != nil {
 		log.Fatal(err)
 	}
 
-	var cards []trana.Card
-	if json.NewDecoder(file).Decode(&cards); err != nil {
+	br := bufio.NewReader(file)
+	format, err := detectFormat(br)
+	if err != nil {
 		log.Fatal(err)
 	}
-
-	if err = s.trana.Import(r.Context(), deck, cards); err != nil {
+	token, err := s.uploads.save(br)
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Imports are reviewed before they are committed
 	url := url.URL{
-		Path: "/cards",
+		Path: "/import/" + format,
 	}
 	query := url.Query()
 	query.Add("deck", r.Form.Get("deck"))
+	query.Add("upload", token)
 	url.RawQuery = query.Encode()
 
 	http.Redirect(w, r, url.String(), http.StatusSeeOther)
 }
 
 func (s *server) ExportCards(w http.ResponseWriter, r *http.Request) {
-	deck, err := strconv.ParseInt(r.URL.Query().Get("deck"), 10, 64)
+	id, err := strconv.ParseInt(r.URL.Query().Get("deck"), 10, 64)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	cards, err := s.trana.ListCards(r.Context(), deck)
+	deck, err := s.trana.GetDeck(r.Context(), id)
 	if err != nil {
 		log.Fatal(err)
 	}
-	now := time.Now().UTC().Format(time.RFC3339)
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="trana-deck-%d-%s.json"`, deck, now))
-	w.Header().Set("Content-Type", "application/json")
 
-	e := json.NewEncoder(w)
-	e.SetIndent("", "\t")
-	if err = e.Encode(cards); err != nil {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatJSON
+	}
+	contentType, ok := exportTypes[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown export format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	// The printable layout is opened in the browser, the rest are downloaded
+	if format != formatHTML {
+		now := time.Now().UTC().Format(time.RFC3339)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="trana-deck-%d-%s.%s"`, deck.ID, now, format))
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	list := r.URL.Query().Get("style") == "list"
+	if err = exportCards(r.Context(), s.trana, s.templates, deck, format, list, w); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/esote/trana"
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestServer returns the pages of a server with an empty collection in
+// memory, opened with opts. Pages are rendered without the vendored assets.
+func newTestServer(t *testing.T, opts *trana.Options) (*server, http.Handler) {
+	t.Helper()
+	tr, err := trana.New(":memory:", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tr.Close() })
+
+	static := &staticAssets{
+		files:  make(map[string]*staticFile),
+		assets: make(map[string]asset),
+	}
+	templates, err := loadTemplates(static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := newUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { uploads.Close() })
+
+	s := &server{
+		trana:     tr,
+		templates: templates,
+		config:    defaultConfig(),
+		uploads:   uploads,
+		undos:     newUndoStacks(),
+	}
+	r := chi.NewRouter()
+	s.routes(r, static, t.TempDir())
+	return s, r
+}
+
+// do serves a request, with the cookies of the session, and returns the
+// response.
+func do(t *testing.T, h http.Handler, r *http.Request, cookies []*http.Cookie) *http.Response {
+	t.Helper()
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Result()
+}
+
+func postForm(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func createTestDeck(t *testing.T, s *server) int64 {
+	t.Helper()
+	deck, err := s.trana.CreateDeck(context.Background(), "Swedish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deck
+}
+
+func TestCardStateNotFound(t *testing.T) {
+	s, h := newTestServer(t, nil)
+	deck := createTestDeck(t, s)
+	card, err := s.trana.CreateCard(context.Background(), deck, "hund", "dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]struct {
+		card int64
+		want int
+	}{
+		"card":    {card: card, want: http.StatusSeeOther},
+		"unknown": {card: card + 1, want: http.StatusNotFound},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			resp := do(t, h, postForm("/card/state", url.Values{
+				"deck":  {strconv.FormatInt(deck, 10)},
+				"card":  {strconv.FormatInt(tc.card, 10)},
+				"state": {"suspend"},
+			}), nil)
+			if resp.StatusCode != tc.want {
+				t.Fatalf("status %d; want %d", resp.StatusCode, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/esote/trana"
+)
+
+// trashPurgeInterval is how often the server purges expired decks and cards
+// from the trash, in addition to when it starts.
+const trashPurgeInterval = time.Hour
+
+// purgeTrash purges the trash every trashPurgeInterval until ctx is done.
+func purgeTrash(ctx context.Context, t *trana.Trana) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.PurgeTrash(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+type Trash struct {
+	Trash *trana.Trash
+}
+
+func (s *server) Trash(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var page Trash
+
+	page.Trash, err = s.trana.ListTrash(r.Context())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = s.template("trash", w, r, &page); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *server) RestoreTrashSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	id, err := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch r.Form.Get("kind") {
+	case "deck":
+		err = s.trana.RestoreDeck(r.Context(), id)
+	case "card":
+		err = s.trana.RestoreCard(r.Context(), id)
+	default:
+		http.Error(w, "unknown kind", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not in the trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
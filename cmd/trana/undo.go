@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esote/trana"
+)
+
+const (
+	// Actions which can be undone in each session, older ones are dropped
+	undoLimit = 20
+
+	// Sessions unused for longer are dropped
+	undoSessionAge = 24 * time.Hour
+
+	sessionCookie = "trana_session"
+)
+
+// undoAction is a review, edit or deletion which can be undone.
+type undoAction struct {
+	// Describes what is undone, such as "Reviewed hund"
+	Label string
+
+	undo func(ctx context.Context, t *trana.Trana) error
+
+	// Whether the toast for the action was shown
+	shown bool
+}
+
+type undoSession struct {
+	actions []*undoAction
+	used    time.Time
+}
+
+// undoStacks are the actions of each browser session, identified by a cookie.
+// They are kept in memory only.
+type undoStacks struct {
+	mu       sync.Mutex
+	sessions map[string]*undoSession
+}
+
+func newUndoStacks() *undoStacks {
+	return &undoStacks{
+		sessions: make(map[string]*undoSession),
+	}
+}
+
+// session returns the session of the request, or nil if it has none and
+// create is false.
+func (u *undoStacks) session(w http.ResponseWriter, r *http.Request, create bool) *undoSession {
+	now := time.Now()
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if s := u.sessions[c.Value]; s != nil {
+			s.used = now
+			return s
+		}
+	}
+	if !create {
+		return nil
+	}
+
+	for id, s := range u.sessions {
+		if now.Sub(s.used) > undoSessionAge {
+			delete(u.sessions, id)
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	id := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	s := &undoSession{used: now}
+	u.sessions[id] = s
+	return s
+}
+
+// push records an action of the session, shown with an undo toast on the next
+// page.
+func (u *undoStacks) push(w http.ResponseWriter, r *http.Request, label string, undo func(context.Context, *trana.Trana) error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s := u.session(w, r, true)
+	s.actions = append(s.actions, &undoAction{Label: label, undo: undo})
+	if len(s.actions) > undoLimit {
+		s.actions = s.actions[len(s.actions)-undoLimit:]
+	}
+}
+
+// pop removes the last action of the session, nil if there is none. The toast
+// of the action before it is shown again.
+func (u *undoStacks) pop(w http.ResponseWriter, r *http.Request) *undoAction {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s := u.session(w, r, false)
+	if s == nil || len(s.actions) == 0 {
+		return nil
+	}
+	a := s.actions[len(s.actions)-1]
+	s.actions = s.actions[:len(s.actions)-1]
+	if len(s.actions) > 0 {
+		s.actions[len(s.actions)-1].shown = false
+	}
+	return a
+}
+
+// toast returns the last action of the session if its toast was not shown
+// yet, marking it shown.
+func (u *undoStacks) toast(w http.ResponseWriter, r *http.Request) *undoToast {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s := u.session(w, r, false)
+	if s == nil || len(s.actions) == 0 {
+		return nil
+	}
+	a := s.actions[len(s.actions)-1]
+	if a.shown {
+		return nil
+	}
+	a.shown = true
+	return &undoToast{
+		Label:  a.Label,
+		Return: r.URL.RequestURI(),
+	}
+}
+
+// undoToast is shown by the layout after an action which can be undone.
+type undoToast struct {
+	Label string
+
+	// Page to return to after undoing
+	Return string
+}
+
+func (s *server) UndoSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Fatal(err)
+	}
+
+	ret := r.Form.Get("return")
+	if !localPath(ret) {
+		ret = "/"
+	}
+
+	a := s.undos.pop(w, r)
+	if a == nil {
+		http.Error(w, "nothing to undo", http.StatusNotFound)
+		return
+	}
+	err := a.undo(r.Context(), s.trana)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "cannot undo: "+a.Label, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.Redirect(w, r, ret, http.StatusSeeOther)
+}
+
+// localPath reports whether a page to return to is on this site. Browsers read
+// backslashes as slashes and drop tabs and newlines, so "/\host" leads to
+// another site like "//host" does.
+func localPath(p string) bool {
+	if strings.ContainsAny(p, "\\\t\r\n") {
+		return false
+	}
+	u, err := url.Parse(p)
+	return err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//")
+}
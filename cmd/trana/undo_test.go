@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/esote/trana"
+)
+
+// undo undoes the last action of the session of cookies.
+func undo(t *testing.T, h http.Handler, cookies []*http.Cookie) *http.Response {
+	t.Helper()
+	return do(t, h, postForm("/undo", url.Values{"return": {"/"}}), cookies)
+}
+
+func TestUndoDeckEdit(t *testing.T) {
+	ctx := context.Background()
+	s, h := newTestServer(t, nil)
+	deck := createTestDeck(t, s)
+	learning := []time.Duration{time.Minute, 10 * time.Minute}
+	relearning := []time.Duration{10 * time.Minute}
+	if err := s.trana.SetLearningSteps(ctx, deck, learning, relearning); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.trana.GetDeckSettings(ctx, deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, err := s.trana.CreateDeckSettings(ctx, &trana.DeckSettings{Name: "Slow", Order: trana.OrderCreated, NewLimit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := do(t, h, postForm("/deck/update", url.Values{
+		"deck":             {strconv.FormatInt(deck, 10)},
+		"name":             {"Svenska"},
+		"learning_steps":   {"5m 1h"},
+		"relearning_steps": {""},
+		"settings":         {strconv.FormatInt(slow, 10)},
+	}), nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("edit status %d; want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	cookies := resp.Cookies()
+	if settings, err := s.trana.GetDeckSettings(ctx, deck); err != nil || settings.ID != slow {
+		t.Fatalf("settings %+v, %v after the edit; want Slow", settings, err)
+	}
+
+	// Undo is kept per session
+	if resp = undo(t, h, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("undo of another session status %d; want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if resp = undo(t, h, cookies); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("undo status %d; want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+
+	got, err := s.trana.GetDeck(ctx, deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Swedish" {
+		t.Errorf("name %q after undo; want %q", got.Name, "Swedish")
+	}
+	if trana.FormatSteps(got.LearningSteps) != "1m 10m" || trana.FormatSteps(got.RelearningSteps) != "10m" {
+		t.Errorf("steps %v, %v after undo; want %v, %v", got.LearningSteps, got.RelearningSteps, learning, relearning)
+	}
+	settings, err := s.trana.GetDeckSettings(ctx, deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.ID != before.ID {
+		t.Errorf("settings %+v after undo; want %+v", settings, before)
+	}
+
+	if resp = undo(t, h, cookies); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("second undo status %d; want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestUndoReview(t *testing.T) {
+	ctx := context.Background()
+	s, h := newTestServer(t, &trana.Options{BurySiblings: true})
+	deck := createTestDeck(t, s)
+	card, err := s.trana.CreateCard(ctx, deck, "hund", "dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sibling, err := s.trana.CreateCard(ctx, deck, "dog", "hund")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := do(t, h, postForm("/card/check", url.Values{
+		"deck":    {strconv.FormatInt(deck, 10)},
+		"card":    {strconv.FormatInt(card, 10)},
+		"comfort": {strconv.Itoa(trana.ComfortReviewMax)},
+	}), nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("review status %d; want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	got, err := s.trana.GetCard(ctx, sibling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BuriedUntil == nil {
+		t.Fatal("sibling was not buried")
+	}
+
+	if resp = undo(t, h, resp.Cookies()); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("undo status %d; want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	if got, err = s.trana.GetCard(ctx, card); err != nil {
+		t.Fatal(err)
+	}
+	if got.LastPracticed != nil || got.Comfort != -1 {
+		t.Errorf("card %+v after undo; want not practiced", got)
+	}
+	if got, err = s.trana.GetCard(ctx, sibling); err != nil {
+		t.Fatal(err)
+	}
+	if got.BuriedUntil != nil {
+		t.Errorf("sibling buried until %v after undo; want unburied", got.BuriedUntil)
+	}
+}
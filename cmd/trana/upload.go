@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// uploadExpiry is how long an upload is kept for a multi-step import.
+const uploadExpiry = time.Hour
+
+// uploads keeps uploaded files on disk between the steps of an import, such as
+// choosing a field mapping before importing.
+type uploads struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*upload
+}
+
+type upload struct {
+	path    string
+	size    int64
+	created time.Time
+}
+
+func newUploads() (*uploads, error) {
+	dir, err := os.MkdirTemp("", "trana-uploads-*")
+	if err != nil {
+		return nil, err
+	}
+	return &uploads{
+		dir:   dir,
+		files: make(map[string]*upload),
+	}, nil
+}
+
+func (u *uploads) Close() error {
+	return os.RemoveAll(u.dir)
+}
+
+// save stores the upload and returns a token to retrieve it.
+func (u *uploads) save(r io.Reader) (string, error) {
+	u.expire()
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b[:])
+
+	f, err := os.CreateTemp(u.dir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+	size, err := io.Copy(f, r)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.files[token] = &upload{
+		path:    f.Name(),
+		size:    size,
+		created: time.Now(),
+	}
+	return token, nil
+}
+
+// open returns the upload and its size, or os.ErrNotExist if the token is
+// unknown or expired.
+func (u *uploads) open(token string) (*os.File, int64, error) {
+	u.mu.Lock()
+	up, ok := u.files[token]
+	u.mu.Unlock()
+	if !ok {
+		return nil, 0, os.ErrNotExist
+	}
+	f, err := os.Open(up.path)
+	return f, up.size, err
+}
+
+func (u *uploads) remove(token string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if up, ok := u.files[token]; ok {
+		os.Remove(up.path)
+		delete(u.files, token)
+	}
+}
+
+func (u *uploads) expire() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for token, up := range u.files {
+		if time.Since(up.created) > uploadExpiry {
+			os.Remove(up.path)
+			delete(u.files, token)
+		}
+	}
+}
+
+func (u *uploads) read(token string) ([]byte, error) {
+	f, _, err := u.open(token)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// uploadExpired responds that an upload is gone if err is from an unknown or
+// expired token, reporting whether it did.
+func uploadExpired(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	http.Error(w, "upload expired, upload the file again", http.StatusGone)
+	return true
+}
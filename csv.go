@@ -0,0 +1,259 @@
+package trana
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// CSVEncodings are the supported encodings of CSV files.
+var CSVEncodings = []string{"utf-8", "utf-16le", "utf-16be", "windows-1252"}
+
+// CSVDelimiters are the supported delimiters of CSV files, tab is TSV.
+var CSVDelimiters = []rune{',', '\t', ';'}
+
+// CSVOptions describe how a CSV file is parsed.
+type CSVOptions struct {
+	Delimiter rune
+	Encoding  string
+
+	// First row is a header
+	Header bool
+}
+
+// CSVMapping chooses the columns, by index, which become the fields of cards.
+// Tags and Comfort are optional and -1 when unused.
+type CSVMapping struct {
+	Front   int
+	Back    int
+	Tags    int
+	Comfort int
+}
+
+// CSVFile is a parsed CSV or TSV file.
+type CSVFile struct {
+	Options CSVOptions
+
+	// Column names, from the header or numbered
+	Columns []string
+
+	Rows [][]string
+}
+
+// DetectCSV guesses the encoding, delimiter, and header of a CSV file.
+func DetectCSV(data []byte) CSVOptions {
+	opts := CSVOptions{
+		Encoding: detectEncoding(data),
+	}
+	text, err := decode(data, opts.Encoding)
+	if err != nil {
+		text = string(data)
+	}
+
+	// The delimiter found most consistently in the first lines
+	lines := strings.SplitN(text, "\n", 11)
+	if len(lines) > 10 {
+		lines = lines[:10]
+	}
+	best := -1
+	for _, d := range CSVDelimiters {
+		min := -1
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			n := strings.Count(line, string(d))
+			if min == -1 || n < min {
+				min = n
+			}
+		}
+		if min > best {
+			best = min
+			opts.Delimiter = d
+		}
+	}
+
+	if header := strings.ToLower(lines[0]); strings.Contains(header, "front") && strings.Contains(header, "back") {
+		opts.Header = true
+	}
+	return opts
+}
+
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return "utf-8"
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	case utf8.Valid(data):
+		return "utf-8"
+	default:
+		// Spreadsheets on Windows often save as Windows-1252
+		return "windows-1252"
+	}
+}
+
+func decode(data []byte, name string) (string, error) {
+	var enc encoding.Encoding
+	switch name {
+	case "utf-8":
+		enc = unicode.UTF8BOM
+	case "utf-16le":
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case "utf-16be":
+		enc = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	case "windows-1252":
+		enc = charmap.Windows1252
+	default:
+		return "", fmt.Errorf("trana: unsupported encoding %q", name)
+	}
+	b, _, err := transform.Bytes(enc.NewDecoder(), data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ReadCSV parses a CSV file.
+func ReadCSV(r io.Reader, opts CSVOptions) (*CSVFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text, err := decode(data, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := csv.NewReader(strings.NewReader(text))
+	cr.Comma = opts.Delimiter
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &CSVFile{Options: opts}
+	if opts.Header && len(rows) > 0 {
+		f.Columns = rows[0]
+		rows = rows[1:]
+	}
+	f.Rows = rows
+
+	width := len(f.Columns)
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	for i := len(f.Columns); i < width; i++ {
+		f.Columns = append(f.Columns, "Column "+strconv.Itoa(i+1))
+	}
+	return f, nil
+}
+
+// DefaultMapping maps columns named front, back, tags and comfort, otherwise
+// the first two columns are front and back.
+func (f *CSVFile) DefaultMapping() CSVMapping {
+	m := CSVMapping{Front: -1, Back: -1, Tags: -1, Comfort: -1}
+	for i, name := range f.Columns {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "front":
+			m.Front = i
+		case "back":
+			m.Back = i
+		case "tags":
+			m.Tags = i
+		case "comfort":
+			m.Comfort = i
+		}
+	}
+	if m.Front == -1 || m.Back == -1 {
+		m.Front, m.Back = 0, 1
+	}
+	return m
+}
+
+// Cards converts rows to cards. Errors name the row of the file, counting the
+// header.
+func (f *CSVFile) Cards(m CSVMapping) ([]Card, error) {
+	if m.Front < 0 || m.Back < 0 {
+		return nil, errors.New("trana: front and back columns are required")
+	}
+	first := 1
+	if f.Options.Header {
+		first++
+	}
+
+	cell := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	var cards []Card
+	for i, row := range f.Rows {
+		card := Card{
+			Front:   cleanString(cell(row, m.Front)),
+			Back:    cleanString(cell(row, m.Back)),
+			Tags:    strings.Fields(cell(row, m.Tags)),
+			Comfort: -1,
+		}
+		if card.Front == "" && card.Back == "" {
+			// Blank line
+			continue
+		}
+		if card.Front == "" || card.Back == "" {
+			return nil, fmt.Errorf("row %d: front and back must not be empty", first+i)
+		}
+		if comfort := strings.TrimSpace(cell(row, m.Comfort)); comfort != "" {
+			c, err := strconv.ParseFloat(comfort, 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid comfort %q", first+i, comfort)
+			}
+			if c != -1 && (c < ComfortMin || c > ComfortMax) {
+				return nil, fmt.Errorf("row %d: %w", first+i, ErrBadComfort)
+			}
+			card.Comfort = c
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+// WriteCSV writes cards as UTF-8 CSV with a header, which ReadCSV and
+// DefaultMapping read back.
+func WriteCSV(w io.Writer, cards []Card, delimiter rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+	if err := cw.Write([]string{"front", "back", "tags", "comfort"}); err != nil {
+		return err
+	}
+	for _, card := range cards {
+		record := []string{
+			card.Front,
+			card.Back,
+			strings.Join(card.Tags, " "),
+			strconv.FormatFloat(card.Comfort, 'f', -1, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
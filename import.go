@@ -0,0 +1,422 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ImportPolicy resolves a conflict between an imported card and a card in the
+// deck with the same front but a different back.
+type ImportPolicy string
+
+const (
+	// Fail the import
+	ConflictAbort ImportPolicy = ""
+
+	// Keep the existing card, skipping the imported card
+	ConflictKeep ImportPolicy = "keep"
+
+	// Replace the existing card with the imported card
+	ConflictOverwrite ImportPolicy = "overwrite"
+
+	// Keep both cards
+	ConflictBoth ImportPolicy = "both"
+
+	// Add the back of the imported card to the existing card as an
+	// alternative, see Matching.Equal
+	ConflictMerge ImportPolicy = "merge"
+)
+
+// ImportPolicies are the policies which resolve a conflict.
+var ImportPolicies = []ImportPolicy{ConflictKeep, ConflictOverwrite, ConflictBoth, ConflictMerge}
+
+var ErrBadImportPolicy = errors.New("trana: unknown import conflict policy")
+
+func (p ImportPolicy) Valid() bool {
+	switch p {
+	case ConflictAbort, ConflictKeep, ConflictOverwrite, ConflictBoth, ConflictMerge:
+		return true
+	default:
+		return false
+	}
+}
+
+type ImportOptions struct {
+	// Policy for conflicts without a policy in Policies
+	Conflict ImportPolicy
+
+	// Policies of single conflicts, by card index
+	Policies map[int]ImportPolicy
+
+	// Report what would be imported without changing the deck. Conflicts
+	// without a policy are reported instead of failing the import.
+	DryRun bool
+
+	// Called with the number of cards read so far, after every batch of cards
+	// and once all cards are read
+	Progress func(n int)
+}
+
+func (o *ImportOptions) policy(i int) ImportPolicy {
+	if p, ok := o.Policies[i]; ok {
+		return p
+	}
+	return o.Conflict
+}
+
+type ImportStatus string
+
+const (
+	ImportInserted  ImportStatus = "inserted"
+	ImportUpdated   ImportStatus = "updated"
+	ImportUnchanged ImportStatus = "unchanged"
+	ImportConflict  ImportStatus = "conflict"
+)
+
+// ImportResult is what was done with one imported card.
+type ImportResult struct {
+	Index  int
+	Status ImportStatus
+	Card   Card
+
+	// Card in the deck with the same UUID or front, nil if the card was
+	// inserted. It may be an earlier card of the same import.
+	Existing *Card
+
+	// Policy which resolved a conflict
+	Policy ImportPolicy
+}
+
+// ImportReport counts what was done with the imported cards. Only the results
+// of conflicting cards are kept, so that reports of large imports stay small.
+type ImportReport struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+	Conflicts int
+
+	// Notes of an Anki package which were not imported, see ImportAnki
+	Skipped int
+
+	Conflicting []ImportResult
+}
+
+// CardReader reads cards one at a time. Read returns io.EOF after the last
+// card.
+type CardReader interface {
+	Read() (Card, error)
+}
+
+type cardSlice []Card
+
+func (s *cardSlice) Read() (Card, error) {
+	if len(*s) == 0 {
+		return Card{}, io.EOF
+	}
+	card := (*s)[0]
+	*s = (*s)[1:]
+	return card, nil
+}
+
+// importBatch is the number of cards imported between calls of Progress.
+const importBatch = 1000
+
+var errDryRun = errors.New("dry run")
+
+// Import imports cards into the deck, failing on the first conflict.
+func (t *Trana) Import(ctx context.Context, deck int64, cards []Card) error {
+	_, err := t.ImportCards(ctx, deck, cards, nil)
+	return err
+}
+
+// ImportCards imports cards into the deck, see ImportFrom.
+func (t *Trana) ImportCards(ctx context.Context, deck int64, cards []Card, opts *ImportOptions) (*ImportReport, error) {
+	s := cardSlice(cards)
+	return t.ImportFrom(ctx, deck, &s, opts)
+}
+
+// ImportFrom imports the cards of r into the deck and reports what was done
+// with them. Cards already in the deck with the same UUID, or with the same
+// front and back, are updated with the imported card, adding its tags. The import
+// is one transaction, cancelled with ctx.
+func (t *Trana) ImportFrom(ctx context.Context, deck int64, r CardReader, opts *ImportOptions) (*ImportReport, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	if !opts.Conflict.Valid() {
+		return nil, ErrBadImportPolicy
+	}
+	for _, p := range opts.Policies {
+		if !p.Valid() {
+			return nil, ErrBadImportPolicy
+		}
+	}
+
+	var report ImportReport
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		stmts, err := prepareImport(tx)
+		if err != nil {
+			return err
+		}
+		defer stmts.Close()
+
+		i := 0
+		for ; ; i++ {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			if opts.Progress != nil && i > 0 && i%importBatch == 0 {
+				opts.Progress(i)
+			}
+
+			card, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// Readers wrap errors of single cards in CardError
+				return err
+			}
+			if err = validateCard(card.Front, card.Back, card.Comfort); err != nil {
+				return &CardError{Index: i, Err: err}
+			}
+
+			result := ImportResult{
+				Index:  i,
+				Card:   card,
+				Policy: opts.policy(i),
+			}
+			if _, err = stmts.importCard(deck, &result); err != nil {
+				return &CardError{Index: i, Err: err}
+			}
+			if result.Status == ImportConflict && result.Policy == ConflictAbort && !opts.DryRun {
+				return &CardError{
+					Index: i,
+					Err:   fmt.Errorf("same front as existing card %d but a different back", result.Existing.ID),
+				}
+			}
+
+			switch result.Status {
+			case ImportInserted:
+				report.Inserted++
+			case ImportUpdated:
+				report.Updated++
+			case ImportUnchanged:
+				report.Unchanged++
+			case ImportConflict:
+				report.Conflicts++
+				report.Conflicting = append(report.Conflicting, result)
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(i)
+		}
+
+		if opts.DryRun {
+			// Roll back
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// importStmts are the statements of an import, prepared once for all cards.
+type importStmts struct {
+	findUUID  *sql.Stmt
+	find      *sql.Stmt
+	insert    *sql.Stmt
+	update    *sql.Stmt
+	overwrite *sql.Stmt
+	merge     *sql.Stmt
+	revise    *sql.Stmt
+	uuidUsed  *sql.Stmt
+
+	// Modification time of the imported cards, in Unix milliseconds
+	now int64
+}
+
+func prepareImport(tx *sql.Tx) (*importStmts, error) {
+	s := importStmts{now: time.Now().UnixMilli()}
+	for _, p := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.findUUID, `SELECT ` + cardColumns + `
+			FROM "cards"
+			WHERE "deck" = @deck AND "uuid" = @uuid AND "deleted" IS NULL`},
+		{&s.find, `SELECT ` + cardColumns + `
+			FROM "cards"
+			WHERE "deck" = @deck AND "front" = @front AND "deleted" IS NULL
+			LIMIT 1`},
+		{&s.insert, `INSERT INTO "cards" ("uuid", "deck", "front", "back", "tags", "last_practiced", "comfort", "suspended", "buried_until", "content_modified", "modified", "changed")
+			VALUES (@uuid, @deck, @front, @back, @tags, @lastPracticed, @comfort, @suspended, @buriedUntil, @now, @now, @now)`},
+		{&s.update, `UPDATE "cards"
+			SET "tags" = @tags, "last_practiced" = @lastPracticed, "comfort" = @comfort, "suspended" = @suspended, "buried_until" = @buriedUntil, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`},
+		{&s.overwrite, `UPDATE "cards"
+			SET "front" = @front, "back" = @back, "tags" = @tags, "last_practiced" = @lastPracticed, "comfort" = @comfort, "suspended" = @suspended, "buried_until" = @buriedUntil, "content_modified" = @now, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`},
+		{&s.merge, `UPDATE "cards"
+			SET "back" = @back, "tags" = @tags, "content_modified" = @now, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`},
+		{&s.revise, reviseQuery},
+		{&s.uuidUsed, uuidUsedQuery("cards")},
+	} {
+		var err error
+		if *p.stmt, err = tx.Prepare(p.query); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+func (s *importStmts) Close() {
+	for _, stmt := range []*sql.Stmt{s.findUUID, s.find, s.insert, s.update, s.overwrite, s.merge, s.revise, s.uuidUsed} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// importCard imports result.Card, filling in the rest of result, and returns
+// the ID of the imported or existing card. The card matches a card in the deck
+// with the same UUID, whose front and back it replaces, or else a card with the
+// same front.
+func (s *importStmts) importCard(deck int64, result *ImportResult) (int64, error) {
+	card := &result.Card
+	card.Front = cleanString(card.Front)
+	card.Back = cleanString(card.Back)
+	card.Tags = strings.Fields(joinTags(card.Tags))
+
+	var existing Card
+	err := sql.ErrNoRows
+	byUUID := false
+	if card.UUID = cleanUUID(card.UUID); card.UUID != "" {
+		err = scanCard(s.findUUID.QueryRow(deck, card.UUID), &existing)
+		byUUID = err == nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		err = scanCard(s.find.QueryRow(deck, card.Front), &existing)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		result.Status = ImportInserted
+		return s.insertCard(deck, card)
+	}
+	if err != nil {
+		return 0, err
+	}
+	result.Existing = &existing
+
+	var lastPracticed sql.NullInt64
+	if card.LastPracticed != nil {
+		lastPracticed.Valid = true
+		lastPracticed.Int64 = card.LastPracticed.Unix()
+	}
+	tags := joinTags(append(existing.Tags, card.Tags...))
+
+	if existing.Front == card.Front && hasBacks(existing.Back, card.Back) {
+		if tags == joinTags(existing.Tags) && existing.Comfort == card.Comfort && sameTime(existing.LastPracticed, card.LastPracticed) &&
+			existing.Suspended == card.Suspended && sameTime(existing.BuriedUntil, card.BuriedUntil) {
+			result.Status = ImportUnchanged
+			return existing.ID, nil
+		}
+		// Card is already in deck, override last_practiced, comfort,
+		// suspension and burial and add new tags
+		result.Status = ImportUpdated
+		_, err = s.update.Exec(tags, lastPracticed, card.Comfort, card.Suspended, nullUnix(card.BuriedUntil), s.now, existing.ID)
+		return existing.ID, err
+	}
+
+	if byUUID {
+		// Same card, edited in the collection it was exported from
+		result.Status = ImportUpdated
+		if _, err = s.revise.Exec(s.now, RevisionImport, card.Front, card.Back, existing.ID); err != nil {
+			return 0, err
+		}
+		_, err = s.overwrite.Exec(card.Front, card.Back, tags, lastPracticed, card.Comfort, card.Suspended, nullUnix(card.BuriedUntil), s.now, existing.ID)
+		return existing.ID, err
+	}
+
+	result.Status = ImportConflict
+	switch result.Policy {
+	case ConflictOverwrite:
+		if _, err = s.revise.Exec(s.now, RevisionImport, card.Front, card.Back, existing.ID); err != nil {
+			return 0, err
+		}
+		_, err = s.overwrite.Exec(card.Front, card.Back, joinTags(card.Tags), lastPracticed, card.Comfort, card.Suspended, nullUnix(card.BuriedUntil), s.now, existing.ID)
+		return existing.ID, err
+	case ConflictBoth:
+		return s.insertCard(deck, card)
+	case ConflictMerge:
+		back := mergeBacks(existing.Back, card.Back)
+		if _, err = s.revise.Exec(s.now, RevisionImport, existing.Front, back, existing.ID); err != nil {
+			return 0, err
+		}
+		_, err = s.merge.Exec(back, tags, s.now, existing.ID)
+		return existing.ID, err
+	default:
+		// Kept, or left to the caller to abort
+		return existing.ID, nil
+	}
+}
+
+func (s *importStmts) insertCard(deck int64, card *Card) (int64, error) {
+	var lastPracticed sql.NullInt64
+	if card.LastPracticed != nil {
+		lastPracticed.Valid = true
+		lastPracticed.Int64 = card.LastPracticed.Unix()
+	}
+
+	uuid, err := freeUUID(s.uuidUsed, card.UUID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.insert.Exec(uuid, deck, card.Front, card.Back, joinTags(card.Tags), lastPracticed, card.Comfort, card.Suspended, nullUnix(card.BuriedUntil), s.now)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// hasBacks reports whether all alternatives of back are alternatives of
+// existing.
+func hasBacks(existing, back string) bool {
+	return mergeBacks(existing, back) == strings.Join(alternatives(existing), "\n")
+}
+
+// mergeBacks adds the alternatives of back missing from existing, one per
+// line.
+func mergeBacks(existing, back string) string {
+	alts := alternatives(existing)
+	for _, alt := range alternatives(back) {
+		found := false
+		for _, a := range alts {
+			if a == alt {
+				found = true
+				break
+			}
+		}
+		if !found {
+			alts = append(alts, alt)
+		}
+	}
+	return strings.Join(alts, "\n")
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Unix() == b.Unix()
+}
@@ -0,0 +1,121 @@
+package trana
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestImportPolicies(t *testing.T) {
+	testcases := map[string]struct {
+		opts ImportOptions
+
+		// Backs of the cards with front hund after the import, sorted
+		backs    []string
+		err      bool
+		inserted int
+		updated  int
+	}{
+		"abort": {
+			opts:  ImportOptions{Conflict: ConflictAbort},
+			backs: []string{"dog"},
+			err:   true,
+		},
+		"dry run": {
+			opts:     ImportOptions{Conflict: ConflictOverwrite, DryRun: true},
+			backs:    []string{"dog"},
+			inserted: 1,
+			updated:  1,
+		},
+		"keep": {
+			opts:     ImportOptions{Conflict: ConflictKeep},
+			backs:    []string{"dog"},
+			inserted: 1,
+			updated:  1,
+		},
+		"overwrite": {
+			opts:     ImportOptions{Conflict: ConflictOverwrite},
+			backs:    []string{"hound"},
+			inserted: 1,
+			updated:  1,
+		},
+		"both": {
+			opts:     ImportOptions{Conflict: ConflictBoth},
+			backs:    []string{"dog", "hound"},
+			inserted: 1,
+			updated:  1,
+		},
+		"merge": {
+			opts:     ImportOptions{Conflict: ConflictMerge},
+			backs:    []string{"dog\nhound"},
+			inserted: 1,
+			updated:  1,
+		},
+		"policy of the card": {
+			opts: ImportOptions{
+				Conflict: ConflictAbort,
+				Policies: map[int]ImportPolicy{0: ConflictOverwrite},
+			},
+			backs:    []string{"hound"},
+			inserted: 1,
+			updated:  1,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			tr := newTestTrana(t)
+			deck, err := tr.CreateDeck(ctx, "Swedish")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range [][2]string{{"hund", "dog"}, {"katt", "cat"}} {
+				if _, err = tr.CreateCard(ctx, deck, c[0], c[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// A conflict, a card already in the deck with a new tag and a
+			// new card
+			report, err := tr.ImportCards(ctx, deck, []Card{
+				{Front: "hund", Back: "hound", Comfort: -1},
+				{Front: "katt", Back: "cat", Tags: []string{"animals"}, Comfort: -1},
+				{Front: "ko", Back: "cow", Comfort: -1},
+			}, &tc.opts)
+			var cardErr *CardError
+			if tc.err {
+				if !errors.As(err, &cardErr) || cardErr.Index != 0 {
+					t.Fatalf("import error %v; want a CardError of card 0", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if report.Inserted != tc.inserted || report.Updated != tc.updated || report.Conflicts != 1 {
+					t.Errorf("report %+v; want %d inserted, %d updated and 1 conflict", report, tc.inserted, tc.updated)
+				}
+			}
+
+			cards, err := tr.ListCards(ctx, deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var backs []string
+			for _, card := range cards {
+				if card.Front == "hund" {
+					backs = append(backs, card.Back)
+				}
+			}
+			sort.Strings(backs)
+			if strings.Join(backs, ",") != strings.Join(tc.backs, ",") {
+				t.Errorf("backs of hund %q; want %q", backs, tc.backs)
+			}
+			if !tc.opts.DryRun && !tc.err && len(cards) != 3+len(tc.backs)-1 {
+				t.Errorf("deck has %d cards; want %d", len(cards), 3+len(tc.backs)-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package trana
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// ExportFormat identifies an exported deck, see deck.schema.json.
+	ExportFormat = "trana-deck"
+
+	// ExportVersion is the version of the export format written by Export.
+	// ReadExport reads this and older versions.
+	ExportVersion = 1
+)
+
+var (
+	// ErrBadExport is returned for a file which is not an export, or whose
+	// structure is invalid. Invalid cards are reported with CardError.
+	ErrBadExport = errors.New("trana: invalid export")
+
+	ErrExportVersion = errors.New("trana: export is from a newer version of trana")
+)
+
+// ExportFile is a deck exported as JSON. Unlike Card, exported cards are
+// identified by UUID rather than by row ID.
+type ExportFile struct {
+	Format  string       `json:"format"`
+	Version int          `json:"version"`
+	Deck    ExportDeck   `json:"deck"`
+	Cards   []ExportCard `json:"cards"`
+}
+
+type ExportDeck struct {
+	UUID string `json:"uuid,omitempty"`
+	Name string `json:"name"`
+}
+
+type ExportCard struct {
+	UUID          string     `json:"uuid,omitempty"`
+	Front         string     `json:"front"`
+	Back          string     `json:"back"`
+	Tags          []string   `json:"tags,omitempty"`
+	LastPracticed *time.Time `json:"last_practiced,omitempty"`
+
+	// -1 if never practiced
+	Comfort float64 `json:"comfort"`
+
+	Suspended   bool       `json:"suspended,omitempty"`
+	BuriedUntil *time.Time `json:"buried_until,omitempty"`
+}
+
+// CardError is an error with one card of an import, by index.
+type CardError struct {
+	Index int
+	Err   error
+}
+
+func (e *CardError) Error() string {
+	return fmt.Sprintf("trana: card %d: %v", e.Index, e.Err)
+}
+
+func (e *CardError) Unwrap() error {
+	return e.Err
+}
+
+// Export returns the deck and its cards as an ExportFile.
+func (t *Trana) Export(ctx context.Context, deck int64) (*ExportFile, error) {
+	d, err := t.GetDeck(ctx, deck)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := t.ListCards(ctx, deck)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ExportFile{
+		Format:  ExportFormat,
+		Version: ExportVersion,
+		Deck: ExportDeck{
+			UUID: d.UUID,
+			Name: d.Name,
+		},
+		Cards: []ExportCard{},
+	}
+	for _, card := range cards {
+		f.Cards = append(f.Cards, ExportCard{
+			UUID:          card.UUID,
+			Front:         card.Front,
+			Back:          card.Back,
+			Tags:          card.Tags,
+			LastPracticed: card.LastPracticed,
+			Comfort:       card.Comfort,
+			Suspended:     card.Suspended,
+			BuriedUntil:   card.BuriedUntil,
+		})
+	}
+	return f, nil
+}
+
+// ReadExport reads and validates an ExportFile, see ExportReader.
+func ReadExport(r io.Reader) (*ExportFile, error) {
+	er, err := NewExportReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var cards []ExportCard
+	for {
+		card, err := er.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, *card)
+	}
+	f := er.File
+	f.Cards = cards
+	return &f, nil
+}
+
+// ExportReader reads and validates the cards of an ExportFile one at a time,
+// so that large files need not fit in memory. Older exports, which are a bare
+// array of Card, are read as well.
+type ExportReader struct {
+	// File without its cards. Fields after the cards in the file are only
+	// known once all cards are read.
+	File ExportFile
+
+	dec    *json.Decoder
+	legacy bool
+	done   bool
+	index  int
+	uuids  map[string]int
+}
+
+func NewExportReader(r io.Reader) (*ExportReader, error) {
+	er, err := newExportReader(r)
+	return er, exportError(err)
+}
+
+func newExportReader(r io.Reader) (*ExportReader, error) {
+	br := bufio.NewReader(r)
+	first, err := firstByte(br)
+	if err != nil {
+		return nil, err
+	}
+
+	er := &ExportReader{
+		dec:   json.NewDecoder(br),
+		uuids: make(map[string]int),
+	}
+	if first == '[' {
+		er.legacy = true
+		er.File.Format = ExportFormat
+		if _, err = er.dec.Token(); err != nil {
+			return nil, err
+		}
+		return er, nil
+	}
+
+	if err = er.expect(json.Delim('{')); err != nil {
+		return nil, err
+	}
+	cards, err := er.readFields()
+	if err != nil {
+		return nil, err
+	}
+	if !cards {
+		// No cards, or they are null
+		er.done = true
+		return er, er.check()
+	}
+	// Reject other formats early, if the format comes before the cards
+	if er.File.Format != "" {
+		if err = er.check(); err != nil {
+			return nil, err
+		}
+	}
+	return er, nil
+}
+
+func (er *ExportReader) expect(delim json.Delim) error {
+	t, err := er.dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %v, got %v", delim, t)
+	}
+	return nil
+}
+
+// readFields reads the fields of the file up to the start of the cards, or to
+// the end of the file. It reports whether it stopped at the cards.
+func (er *ExportReader) readFields() (bool, error) {
+	for er.dec.More() {
+		t, err := er.dec.Token()
+		if err != nil {
+			return false, err
+		}
+		switch t {
+		case "format":
+			err = er.dec.Decode(&er.File.Format)
+		case "version":
+			err = er.dec.Decode(&er.File.Version)
+		case "deck":
+			err = er.dec.Decode(&er.File.Deck)
+		case "cards":
+			if er.index > 0 || er.done {
+				return false, errors.New("cards twice")
+			}
+			t, err := er.dec.Token()
+			if err != nil {
+				return false, err
+			}
+			if t == nil {
+				continue
+			}
+			if t != json.Delim('[') {
+				return false, fmt.Errorf("expected cards array, got %v", t)
+			}
+			return true, nil
+		default:
+			// Unknown fields are ignored
+			var skip json.RawMessage
+			err = er.dec.Decode(&skip)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, er.expect(json.Delim('}'))
+}
+
+func (er *ExportReader) check() error {
+	if er.File.Format != ExportFormat {
+		return fmt.Errorf("unknown format %q", er.File.Format)
+	}
+	if er.File.Version > ExportVersion {
+		return ErrExportVersion
+	}
+	return nil
+}
+
+// readEnd reads the end of the cards and the fields after them.
+func (er *ExportReader) readEnd() error {
+	if err := er.expect(json.Delim(']')); err != nil {
+		return err
+	}
+	if er.legacy {
+		return nil
+	}
+	if _, err := er.readFields(); err != nil {
+		return err
+	}
+	return er.check()
+}
+
+// exportError reports an error reading the file around its cards as
+// ErrBadExport.
+func exportError(err error) error {
+	if err == nil || errors.Is(err, ErrExportVersion) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrBadExport, err)
+}
+
+// Read returns the next card for import, or io.EOF after the last card.
+func (er *ExportReader) Read() (Card, error) {
+	card, err := er.read()
+	if err != nil {
+		return Card{}, err
+	}
+	return Card{
+		UUID:          card.UUID,
+		Front:         card.Front,
+		Back:          card.Back,
+		Tags:          card.Tags,
+		LastPracticed: card.LastPracticed,
+		Comfort:       card.Comfort,
+		Suspended:     card.Suspended,
+		BuriedUntil:   card.BuriedUntil,
+	}, nil
+}
+
+func (er *ExportReader) read() (*ExportCard, error) {
+	if er.done {
+		return nil, io.EOF
+	}
+	if !er.dec.More() {
+		// End of the cards
+		er.done = true
+		if err := er.readEnd(); err != nil {
+			return nil, exportError(err)
+		}
+		return nil, io.EOF
+	}
+
+	i := er.index
+	er.index++
+	var card ExportCard
+	if er.legacy {
+		var c Card
+		if err := er.dec.Decode(&c); err != nil {
+			return nil, &CardError{Index: i, Err: err}
+		}
+		card = ExportCard{
+			Front:         c.Front,
+			Back:          c.Back,
+			Tags:          c.Tags,
+			LastPracticed: c.LastPracticed,
+			Comfort:       c.Comfort,
+			Suspended:     c.Suspended,
+			BuriedUntil:   c.BuriedUntil,
+		}
+	} else if err := er.dec.Decode(&card); err != nil {
+		return nil, &CardError{Index: i, Err: err}
+	}
+
+	if err := validateCard(card.Front, card.Back, card.Comfort); err != nil {
+		return nil, &CardError{Index: i, Err: err}
+	}
+	if card.UUID == "" {
+		return &card, nil
+	}
+	if card.UUID = cleanUUID(card.UUID); card.UUID == "" {
+		return nil, &CardError{Index: i, Err: errors.New("invalid uuid")}
+	}
+	if j, ok := er.uuids[card.UUID]; ok {
+		return nil, &CardError{Index: i, Err: fmt.Errorf("uuid is the same as card %d", j)}
+	}
+	er.uuids[card.UUID] = i
+	return &card, nil
+}
+
+// firstByte peeks at the first byte which is not whitespace or a byte order
+// mark.
+func firstByte(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			br.Discard(1)
+		case 0xef:
+			bom, err := br.Peek(3)
+			if err != nil || !bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+				return b[0], nil
+			}
+			br.Discard(3)
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+func validateCard(front, back string, comfort float64) error {
+	if cleanString(front) == "" {
+		return errors.New("front is empty")
+	}
+	if cleanString(back) == "" {
+		return errors.New("back is empty")
+	}
+	if comfort != -1 && (comfort < ComfortMin || comfort > ComfortMax) {
+		return ErrBadComfort
+	}
+	return nil
+}
+
+// ImportCards returns the cards of the file for Import.
+func (f *ExportFile) ImportCards() []Card {
+	cards := make([]Card, len(f.Cards))
+	for i, card := range f.Cards {
+		cards[i] = Card{
+			UUID:          card.UUID,
+			Front:         card.Front,
+			Back:          card.Back,
+			Tags:          card.Tags,
+			LastPracticed: card.LastPracticed,
+			Comfort:       card.Comfort,
+			Suspended:     card.Suspended,
+			BuriedUntil:   card.BuriedUntil,
+		}
+	}
+	return cards
+}
@@ -0,0 +1,52 @@
+package trana
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadExport(t *testing.T) {
+	const card = `{"front":"hund","back":"dog","comfort":-1}`
+
+	testcases := map[string]struct {
+		file  string
+		err   error
+		cards int
+	}{
+		"export":             {file: `{"format":"trana-deck","version":1,"deck":{"name":"Swedish"},"cards":[` + card + `]}`, cards: 1},
+		"fields after cards": {file: `{"cards":[` + card + `],"format":"trana-deck","version":1}`, cards: 1},
+		"legacy":             {file: `[` + card + `]`, cards: 1},
+		"no cards":           {file: `{"format":"trana-deck","version":1}`},
+		"unknown format":     {file: `{"format":"x","cards":[]}`, err: ErrBadExport},
+		"format after cards": {file: `{"cards":[` + card + `],"format":"x"}`, err: ErrBadExport},
+		"newer version":      {file: `{"format":"trana-deck","version":2,"cards":[]}`, err: ErrExportVersion},
+		"version after cards": {
+			file: `{"cards":[` + card + `],"format":"trana-deck","version":2}`,
+			err:  ErrExportVersion,
+		},
+		"cards twice":  {file: `{"format":"trana-deck","cards":[],"cards":[]}`, err: ErrBadExport},
+		"truncated":    {file: `{"format":"trana-deck","cards":[` + card + `]`, err: ErrBadExport},
+		"not an array": {file: `{"format":"trana-deck","cards":{}}`, err: ErrBadExport},
+		"not json":     {file: `front,back`, err: ErrBadExport},
+		"empty":        {file: ``, err: ErrBadExport},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			f, err := ReadExport(strings.NewReader(tc.file))
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("error %v; want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.Cards) != tc.cards {
+				t.Fatalf("%d cards; want %d", len(f.Cards), tc.cards)
+			}
+		})
+	}
+}
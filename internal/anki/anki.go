@@ -0,0 +1,281 @@
+// Package anki reads and writes Anki .apkg packages.
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// FieldSeparator separates the fields of a note.
+const FieldSeparator = "\x1f"
+
+var ErrUnsupported = errors.New("anki: package uses the newer format, export it with \"Support older Anki versions\"")
+
+type Model struct {
+	ID     int64
+	Name   string
+	Fields []string
+}
+
+type Note struct {
+	ID     int64
+	GUID   string
+	Model  int64
+	Fields []string
+	Tags   []string
+}
+
+// Card is the scheduling state of the first card of a note.
+type Card struct {
+	Note int64
+
+	// Card type: 0 new, 1 learning, 2 review, 3 relearning
+	Type int
+
+	// Interval in days, negative values are seconds
+	Interval int64
+
+	Reps   int
+	Lapses int
+
+	// Time of the last review, if any
+	LastReview *time.Time
+
+	// Left out of review, from queue -1 and queues -2 and -3
+	Suspended bool
+	Buried    bool
+}
+
+type Media struct {
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+type Package struct {
+	Models []Model
+	Notes  []Note
+
+	// Keyed by note ID
+	Cards map[int64]Card
+
+	Media []Media
+}
+
+// Read reads an .apkg package.
+func Read(r io.ReaderAt, size int64) (*Package, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	collection := files["collection.anki21"]
+	if collection == nil {
+		if files["collection.anki21b"] != nil {
+			return nil, ErrUnsupported
+		}
+		collection = files["collection.anki2"]
+	}
+	if collection == nil {
+		return nil, errors.New("anki: package has no collection")
+	}
+
+	pkg, err := readCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Media, err = readMedia(files); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// readCollection copies the collection to a temporary file, since SQLite
+// cannot open a database from memory.
+func readCollection(collection *zip.File) (*Package, error) {
+	tmp, err := os.CreateTemp("", "trana-anki-*.db")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	rc, err := collection.Open()
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	_, err = io.Copy(tmp, rc)
+	rc.Close()
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+tmp.Name()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var pkg Package
+	if pkg.Models, err = readModels(db); err != nil {
+		return nil, err
+	}
+	if pkg.Notes, err = readNotes(db); err != nil {
+		return nil, err
+	}
+	if pkg.Cards, err = readCards(db); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+func readModels(db *sql.DB) ([]Model, error) {
+	var raw string
+	if err := db.QueryRow(`SELECT "models" FROM "col" LIMIT 1`).Scan(&raw); err != nil {
+		return nil, err
+	}
+
+	var models map[string]struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string `json:"name"`
+			Ord  int    `json:"ord"`
+		} `json:"flds"`
+	}
+	if err := json.Unmarshal([]byte(raw), &models); err != nil {
+		return nil, fmt.Errorf("anki: models: %w", err)
+	}
+
+	var result []Model
+	for id, m := range models {
+		model := Model{Name: m.Name}
+		var err error
+		if model.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return nil, fmt.Errorf("anki: model ID %q: %w", id, err)
+		}
+		sort.Slice(m.Fields, func(i, j int) bool {
+			return m.Fields[i].Ord < m.Fields[j].Ord
+		})
+		for _, f := range m.Fields {
+			model.Fields = append(model.Fields, f.Name)
+		}
+		result = append(result, model)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+func readNotes(db *sql.DB) ([]Note, error) {
+	rows, err := db.Query(`SELECT "id", "guid", "mid", "flds", "tags"
+		FROM "notes"
+		ORDER BY "id" ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var note Note
+		var fields, tags string
+		if err = rows.Scan(&note.ID, &note.GUID, &note.Model, &fields, &tags); err != nil {
+			return nil, err
+		}
+		note.Fields = strings.Split(fields, FieldSeparator)
+		note.Tags = strings.Fields(tags)
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+func readCards(db *sql.DB) (map[int64]Card, error) {
+	rows, err := db.Query(`SELECT "nid", "type", "queue", "ivl", "reps", "lapses",
+			(SELECT MAX("id") FROM "revlog" WHERE "cid" = "cards"."id")
+		FROM "cards"
+		ORDER BY "nid" ASC, "ord" ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := make(map[int64]Card)
+	for rows.Next() {
+		var card Card
+		var queue int
+		var lastReview sql.NullInt64
+		if err = rows.Scan(&card.Note, &card.Type, &queue, &card.Interval, &card.Reps, &card.Lapses, &lastReview); err != nil {
+			return nil, err
+		}
+		card.Suspended = queue == -1
+		card.Buried = queue == -2 || queue == -3
+		if _, ok := cards[card.Note]; ok {
+			continue
+		}
+		if lastReview.Valid {
+			// Review log IDs are millisecond timestamps
+			t := time.UnixMilli(lastReview.Int64)
+			card.LastReview = &t
+		}
+		cards[card.Note] = card
+	}
+	return cards, rows.Err()
+}
+
+func readMedia(files map[string]*zip.File) ([]Media, error) {
+	f := files["media"]
+	if f == nil {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// Maps numbered zip entries to media file names
+	var names map[string]string
+	if err = json.NewDecoder(rc).Decode(&names); err != nil {
+		return nil, fmt.Errorf("anki: media: %w", err)
+	}
+
+	var media []Media
+	for entry, name := range names {
+		file := files[entry]
+		if file == nil {
+			continue
+		}
+		name = path.Base(name)
+		if name == "." || name == "/" || name == ".." {
+			continue
+		}
+		media = append(media, Media{
+			Name: name,
+			Open: file.Open,
+		})
+	}
+	sort.Slice(media, func(i, j int) bool {
+		return media[i].Name < media[j].Name
+	})
+	return media, nil
+}
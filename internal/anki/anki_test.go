@@ -0,0 +1,76 @@
+package anki
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	reviewed := time.Now().Add(-48 * time.Hour).Truncate(time.Millisecond)
+	pkg := &Package{
+		Notes: []Note{
+			{ID: 1, Fields: []string{"hund", "dog"}, Tags: []string{"animals"}},
+			{ID: 2, GUID: "abc", Fields: []string{"katt", `cat <img src="cat.jpg">`}},
+		},
+		Cards: map[int64]Card{
+			1: {Note: 1, Type: 2, Interval: 10, Reps: 1, LastReview: &reviewed, Suspended: true},
+			2: {Note: 2, Buried: true},
+		},
+		Media: []Media{
+			{Name: "cat.jpg", Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader("meow")), nil
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "Swedish", pkg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Models) != 1 || strings.Join(got.Models[0].Fields, ",") != "Front,Back" {
+		t.Fatalf("models %+v; want one model with Front and Back", got.Models)
+	}
+	if len(got.Notes) != 2 {
+		t.Fatalf("got %d notes; want 2", len(got.Notes))
+	}
+	for i, note := range got.Notes {
+		want := pkg.Notes[i]
+		if strings.Join(note.Fields, "|") != strings.Join(want.Fields, "|") {
+			t.Errorf("note %d fields %q; want %q", i, note.Fields, want.Fields)
+		}
+		if strings.Join(note.Tags, " ") != strings.Join(want.Tags, " ") {
+			t.Errorf("note %d tags %q; want %q", i, note.Tags, want.Tags)
+		}
+	}
+	if got.Notes[1].GUID != "abc" {
+		t.Errorf("GUID %q; want %q", got.Notes[1].GUID, "abc")
+	}
+
+	card := got.Cards[got.Notes[0].ID]
+	if card.Type != 2 || card.Interval != 10 || card.LastReview == nil || !card.LastReview.Equal(reviewed) || !card.Suspended {
+		t.Errorf("card %+v; want suspended review card with interval 10 reviewed %s", card, reviewed)
+	}
+	if card := got.Cards[got.Notes[1].ID]; card.Type != 0 || card.LastReview != nil || !card.Buried || card.Suspended {
+		t.Errorf("card %+v; want buried new card", card)
+	}
+
+	if len(got.Media) != 1 || got.Media[0].Name != "cat.jpg" {
+		t.Fatalf("media %+v; want cat.jpg", got.Media)
+	}
+	rc, err := got.Media[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if b, _ := io.ReadAll(rc); string(b) != "meow" {
+		t.Errorf("media content %q; want %q", b, "meow")
+	}
+}
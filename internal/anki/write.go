@@ -0,0 +1,368 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const schema = `CREATE TABLE "col" ("id" INTEGER PRIMARY KEY, "crt" INTEGER NOT NULL, "mod" INTEGER NOT NULL, "scm" INTEGER NOT NULL, "ver" INTEGER NOT NULL, "dty" INTEGER NOT NULL, "usn" INTEGER NOT NULL, "ls" INTEGER NOT NULL, "conf" TEXT NOT NULL, "models" TEXT NOT NULL, "decks" TEXT NOT NULL, "dconf" TEXT NOT NULL, "tags" TEXT NOT NULL);
+CREATE TABLE "notes" ("id" INTEGER PRIMARY KEY, "guid" TEXT NOT NULL, "mid" INTEGER NOT NULL, "mod" INTEGER NOT NULL, "usn" INTEGER NOT NULL, "tags" TEXT NOT NULL, "flds" TEXT NOT NULL, "sfld" INTEGER NOT NULL, "csum" INTEGER NOT NULL, "flags" INTEGER NOT NULL, "data" TEXT NOT NULL);
+CREATE TABLE "cards" ("id" INTEGER PRIMARY KEY, "nid" INTEGER NOT NULL, "did" INTEGER NOT NULL, "ord" INTEGER NOT NULL, "mod" INTEGER NOT NULL, "usn" INTEGER NOT NULL, "type" INTEGER NOT NULL, "queue" INTEGER NOT NULL, "due" INTEGER NOT NULL, "ivl" INTEGER NOT NULL, "factor" INTEGER NOT NULL, "reps" INTEGER NOT NULL, "lapses" INTEGER NOT NULL, "left" INTEGER NOT NULL, "odue" INTEGER NOT NULL, "odid" INTEGER NOT NULL, "flags" INTEGER NOT NULL, "data" TEXT NOT NULL);
+CREATE TABLE "revlog" ("id" INTEGER PRIMARY KEY, "cid" INTEGER NOT NULL, "usn" INTEGER NOT NULL, "ease" INTEGER NOT NULL, "ivl" INTEGER NOT NULL, "lastIvl" INTEGER NOT NULL, "factor" INTEGER NOT NULL, "time" INTEGER NOT NULL, "type" INTEGER NOT NULL);
+CREATE TABLE "graves" ("usn" INTEGER NOT NULL, "oid" INTEGER NOT NULL, "type" INTEGER NOT NULL);
+CREATE INDEX "ix_notes_usn" ON "notes" ("usn");
+CREATE INDEX "ix_cards_usn" ON "cards" ("usn");
+CREATE INDEX "ix_revlog_usn" ON "revlog" ("usn");
+CREATE INDEX "ix_cards_nid" ON "cards" ("nid");
+CREATE INDEX "ix_cards_sched" ON "cards" ("did", "queue", "due");
+CREATE INDEX "ix_revlog_cid" ON "revlog" ("cid");
+CREATE INDEX "ix_notes_csum" ON "notes" ("csum");`
+
+const (
+	defaultDeckID = 1
+	modelID       = 1656000000000
+	day           = 24 * time.Hour
+)
+
+// Write writes a package with one deck of basic front and back notes. Only the
+// first two fields of each note are used and the models of the package are
+// ignored. Cards are keyed by note ID as when reading.
+func Write(w io.Writer, deck string, pkg *Package) error {
+	tmp, err := os.CreateTemp("", "trana-anki-*.db")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err = writeCollection(tmp.Name(), deck, pkg); err != nil {
+		return err
+	}
+
+	z := zip.NewWriter(w)
+	if err = addFile(z, "collection.anki2", tmp.Name()); err != nil {
+		return err
+	}
+
+	names := make(map[string]string)
+	for i, m := range pkg.Media {
+		entry := strconv.Itoa(i)
+		names[entry] = m.Name
+		if err = addMedia(z, entry, &m); err != nil {
+			return err
+		}
+	}
+	mw, err := z.Create("media")
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(mw).Encode(names); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func addFile(z *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func addMedia(z *zip.Writer, entry string, m *Media) error {
+	rc, err := m.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	w, err := z.Create(entry)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+func writeCollection(path, deck string, pkg *Package) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err = db.Exec(schema); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	created := now.Truncate(day)
+	deckID := now.UnixMilli()
+
+	models, decks, dconf, conf, err := collectionJSON(deck, deckID, now)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`INSERT INTO "col"
+		VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		created.Unix(), now.UnixMilli(), now.UnixMilli(), conf, models, decks, dconf); err != nil {
+		return err
+	}
+
+	// Note and card IDs are millisecond timestamps in Anki, offset to keep
+	// them unique
+	base := now.UnixMilli() - int64(len(pkg.Notes))
+	for i, note := range pkg.Notes {
+		if len(note.Fields) < 2 {
+			return errors.New("anki: note needs a front and back field")
+		}
+		fields := note.Fields[:2]
+		guid := note.GUID
+		if guid == "" {
+			if guid, err = newGUID(); err != nil {
+				return err
+			}
+		}
+
+		noteID := base + int64(i)
+		sortField := stripHTML(fields[0])
+		if _, err = tx.Exec(`INSERT INTO "notes"
+			VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')`,
+			noteID, guid, modelID, now.Unix(), joinTags(note.Tags),
+			strings.Join(fields, FieldSeparator), sortField, checksum(sortField)); err != nil {
+			return err
+		}
+
+		card := pkg.Cards[note.ID]
+		cardID := noteID
+		cardType, queue, due := 0, 0, int64(i)
+		ivl := card.Interval
+		if card.Type != 0 && card.LastReview != nil {
+			if ivl < 1 {
+				ivl = 1
+			}
+			// Review cards are due in days since the collection was
+			// created
+			cardType, queue = 2, 2
+			due = int64(card.LastReview.Add(time.Duration(ivl)*day).Sub(created) / day)
+		} else {
+			ivl = 0
+		}
+		if card.Suspended {
+			queue = -1
+		} else if card.Buried {
+			queue = -2
+		}
+		if _, err = tx.Exec(`INSERT INTO "cards"
+			VALUES (?, ?, ?, 0, ?, -1, ?, ?, ?, ?, 2500, ?, ?, 0, 0, 0, 0, '')`,
+			cardID, noteID, deckID, now.Unix(), cardType, queue, due, ivl, card.Reps, card.Lapses); err != nil {
+			return err
+		}
+
+		if cardType == 2 {
+			if _, err = tx.Exec(`INSERT OR IGNORE INTO "revlog"
+				VALUES (?, ?, -1, 3, ?, 0, 2500, 0, 1)`,
+				card.LastReview.UnixMilli(), cardID, ivl); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+func stripHTML(s string) string {
+	return htmlTag.ReplaceAllString(s, "")
+}
+
+// checksum is the first 8 hex digits of the SHA-1 of the sort field, used by
+// Anki to find duplicates.
+func checksum(s string) int64 {
+	sum := sha1.Sum([]byte(s))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+func joinTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " " + strings.Join(tags, " ") + " "
+}
+
+const guidChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_`{|}~"
+
+// newGUID returns a random note GUID in Anki's base91 alphabet.
+func newGUID() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(guidChars)))
+	for i := 0; i < 10; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(guidChars[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+func collectionJSON(deck string, deckID int64, now time.Time) (models, decks, dconf, conf string, err error) {
+	mod := now.Unix()
+	m := map[string]any{
+		strconv.FormatInt(modelID, 10): map[string]any{
+			"id":        modelID,
+			"name":      "Träna",
+			"type":      0,
+			"mod":       mod,
+			"usn":       -1,
+			"sortf":     0,
+			"did":       deckID,
+			"tags":      []string{},
+			"vers":      []int{},
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}",
+			"css":       ".card {\n font-family: arial;\n font-size: 20px;\n text-align: center;\n color: black;\n background-color: white;\n}\n",
+			"req":       []any{[]any{0, "all", []int{0}}},
+			"flds": []any{
+				field("Front", 0),
+				field("Back", 1),
+			},
+			"tmpls": []any{
+				map[string]any{
+					"name":  "Card 1",
+					"ord":   0,
+					"qfmt":  "{{Front}}",
+					"afmt":  "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}",
+					"bqfmt": "",
+					"bafmt": "",
+					"did":   nil,
+				},
+			},
+		},
+	}
+	d := map[string]any{
+		strconv.Itoa(defaultDeckID):   deckJSON(defaultDeckID, "Default", mod),
+		strconv.FormatInt(deckID, 10): deckJSON(deckID, deck, mod),
+	}
+	dc := map[string]any{
+		"1": map[string]any{
+			"id":       1,
+			"name":     "Default",
+			"mod":      0,
+			"usn":      0,
+			"maxTaken": 60,
+			"autoplay": true,
+			"timer":    0,
+			"replayq":  true,
+			"dyn":      false,
+			"new": map[string]any{
+				"delays":        []float64{1, 10},
+				"ints":          []int{1, 4, 7},
+				"initialFactor": 2500,
+				"order":         1,
+				"perDay":        20,
+				"bury":          true,
+				"separate":      true,
+			},
+			"lapse": map[string]any{
+				"delays":      []float64{10},
+				"mult":        0,
+				"minInt":      1,
+				"leechFails":  8,
+				"leechAction": 0,
+			},
+			"rev": map[string]any{
+				"perDay":   200,
+				"ease4":    1.3,
+				"fuzz":     0.05,
+				"ivlFct":   1,
+				"maxIvl":   36500,
+				"bury":     true,
+				"minSpace": 1,
+			},
+		},
+	}
+	c := map[string]any{
+		"activeDecks":   []int64{defaultDeckID},
+		"curDeck":       deckID,
+		"newSpread":     0,
+		"collapseTime":  1200,
+		"timeLim":       0,
+		"estTimes":      true,
+		"dueCounts":     true,
+		"curModel":      modelID,
+		"nextPos":       1,
+		"sortType":      "noteFld",
+		"sortBackwards": false,
+		"addToCur":      true,
+	}
+
+	var b []byte
+	for _, v := range []struct {
+		dst *string
+		src any
+	}{{&models, m}, {&decks, d}, {&dconf, dc}, {&conf, c}} {
+		if b, err = json.Marshal(v.src); err != nil {
+			return
+		}
+		*v.dst = string(b)
+	}
+	return
+}
+
+func field(name string, ord int) map[string]any {
+	return map[string]any{
+		"name":   name,
+		"ord":    ord,
+		"sticky": false,
+		"rtl":    false,
+		"font":   "Arial",
+		"size":   20,
+		"media":  []string{},
+	}
+}
+
+func deckJSON(id int64, name string, mod int64) map[string]any {
+	return map[string]any{
+		"id":               id,
+		"name":             name,
+		"desc":             "",
+		"mod":              mod,
+		"usn":              -1,
+		"dyn":              0,
+		"conf":             1,
+		"collapsed":        false,
+		"browserCollapsed": false,
+		"extendNew":        10,
+		"extendRev":        50,
+		"newToday":         []int{0, 0},
+		"revToday":         []int{0, 0},
+		"lrnToday":         []int{0, 0},
+		"timeToday":        []int{0, 0},
+	}
+}
@@ -21,6 +21,7 @@ func init() {
 
 type DB interface {
 	Tx(ctx context.Context, f func(tx *sql.Tx) error) error
+	Version() (uint, error)
 	Close() error
 }
 
@@ -47,13 +48,30 @@ func NewSQLite(path string) (*SQLiteDB, error) {
 }
 
 func (db *SQLiteDB) Close() error {
-	_, err := db.db.Exec(`PRAGMA optimize`)
+	_, err := db.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	if _, err2 := db.db.Exec(`PRAGMA optimize`); err == nil {
+		err = err2
+	}
 	if err2 := db.db.Close(); err == nil {
 		err = err2
 	}
 	return err
 }
 
+// Version returns the schema version, the number of the last migration.
+func (db *SQLiteDB) Version() (uint, error) {
+	var version uint
+	var dirty bool
+	err := db.db.QueryRow(`SELECT "version", "dirty" FROM "schema_migrations" LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, errors.New("database migration did not finish")
+	}
+	return version, nil
+}
+
 func (db *SQLiteDB) Tx(ctx context.Context, f func(tx *sql.Tx) error) (err error) {
 	var tx *sql.Tx
 	defer func() {
@@ -78,6 +78,18 @@ func TestMigrate(t *testing.T) {
 	}
 
 	// openDB() already did m.Up()
+	version, err := db.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mVersion, _, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != mVersion {
+		t.Fatalf("Version() got %d; want %d", version, mVersion)
+	}
+
 	if err = m.Down(); err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1 @@
+ALTER TABLE "cards" DROP COLUMN "tags";
@@ -0,0 +1,3 @@
+ALTER TABLE "cards" ADD COLUMN "tags" TEXT
+        NOT NULL
+        DEFAULT '';
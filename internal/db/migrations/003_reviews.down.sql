@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "reviews_card";
+DROP TABLE IF EXISTS "reviews";
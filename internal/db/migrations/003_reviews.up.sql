@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS "reviews" (
+        "id" INTEGER
+                PRIMARY KEY
+                NOT NULL,
+        "card" INTEGER
+                NOT NULL
+                REFERENCES "cards" ("id")
+                ON UPDATE CASCADE
+                ON DELETE CASCADE,
+        "time" INTEGER
+                NOT NULL,
+        "comfort" FLOAT
+                NOT NULL
+                CHECK ("comfort" BETWEEN 1 AND 3)
+);
+
+CREATE INDEX IF NOT EXISTS "reviews_card" ON "reviews" ("card");
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "cards_uuid";
+DROP INDEX IF EXISTS "decks_uuid";
+
+ALTER TABLE "cards" DROP COLUMN "uuid";
+ALTER TABLE "decks" DROP COLUMN "uuid";
@@ -0,0 +1,6 @@
+-- Existing rows are given UUIDs when the collection is opened
+ALTER TABLE "decks" ADD COLUMN "uuid" TEXT DEFAULT NULL;
+ALTER TABLE "cards" ADD COLUMN "uuid" TEXT DEFAULT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS "decks_uuid" ON "decks" ("uuid");
+CREATE UNIQUE INDEX IF NOT EXISTS "cards_uuid" ON "cards" ("uuid");
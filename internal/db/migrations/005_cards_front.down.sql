@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "cards_deck_front";
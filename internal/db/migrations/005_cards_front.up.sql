@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS "cards_deck_front" ON "cards" ("deck", "front");
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS "sync_peers";
+DROP INDEX IF EXISTS "tombstones_changed";
+DROP TABLE IF EXISTS "tombstones";
+
+DROP INDEX IF EXISTS "reviews_changed";
+DROP INDEX IF EXISTS "cards_changed";
+DROP INDEX IF EXISTS "decks_changed";
+
+ALTER TABLE "reviews" DROP COLUMN "changed";
+ALTER TABLE "cards" DROP COLUMN "changed";
+ALTER TABLE "cards" DROP COLUMN "modified";
+ALTER TABLE "decks" DROP COLUMN "changed";
+ALTER TABLE "decks" DROP COLUMN "modified";
@@ -0,0 +1,40 @@
+-- "modified" is when a row was last edited, in Unix milliseconds, and is kept
+-- when the row is synced to another collection. "changed" is when the row was
+-- last written in this collection, by an edit or by sync.
+ALTER TABLE "decks" ADD COLUMN "modified" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "decks" ADD COLUMN "changed" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "cards" ADD COLUMN "modified" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "cards" ADD COLUMN "changed" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "reviews" ADD COLUMN "changed" INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS "decks_changed" ON "decks" ("changed");
+CREATE INDEX IF NOT EXISTS "cards_changed" ON "cards" ("changed");
+CREATE INDEX IF NOT EXISTS "reviews_changed" ON "reviews" ("changed");
+
+-- Deleted decks and cards, so that sync deletes them elsewhere
+CREATE TABLE IF NOT EXISTS "tombstones" (
+        "uuid" TEXT
+                PRIMARY KEY
+                NOT NULL,
+        "kind" TEXT
+                NOT NULL
+                CHECK ("kind" IN ('deck', 'card')),
+        "deleted" INTEGER
+                NOT NULL,
+        "changed" INTEGER
+                NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "tombstones_changed" ON "tombstones" ("changed");
+
+-- Progress of sync with other collections, as "changed" times of this
+-- collection (sent) and of the peer (received)
+CREATE TABLE IF NOT EXISTS "sync_peers" (
+        "peer" TEXT
+                PRIMARY KEY
+                NOT NULL,
+        "sent" INTEGER
+                NOT NULL,
+        "received" INTEGER
+                NOT NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE "reviews" DROP COLUMN "duration";
+ALTER TABLE "reviews" DROP COLUMN "correct";
@@ -0,0 +1,4 @@
+-- Whether the typed answer matched and how long it took in milliseconds, NULL
+-- if unknown
+ALTER TABLE "reviews" ADD COLUMN "correct" INTEGER DEFAULT NULL;
+ALTER TABLE "reviews" ADD COLUMN "duration" INTEGER DEFAULT NULL;
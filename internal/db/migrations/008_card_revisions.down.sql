@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "card_revisions_card";
+DROP TABLE IF EXISTS "card_revisions";
@@ -0,0 +1,27 @@
+-- Changes of the front or back of cards, so that an edit can be rolled back.
+-- "time" is in Unix milliseconds. "source" is what made the change.
+CREATE TABLE IF NOT EXISTS "card_revisions" (
+        "id" INTEGER
+                PRIMARY KEY
+                NOT NULL,
+        "card" INTEGER
+                NOT NULL
+                REFERENCES "cards" ("id")
+                ON UPDATE CASCADE
+                ON DELETE CASCADE,
+        "time" INTEGER
+                NOT NULL,
+        "source" TEXT
+                NOT NULL
+                CHECK ("source" IN ('ui', 'api', 'import', 'sync', 'restore')),
+        "old_front" TEXT
+                NOT NULL,
+        "old_back" TEXT
+                NOT NULL,
+        "new_front" TEXT
+                NOT NULL,
+        "new_back" TEXT
+                NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "card_revisions_card" ON "card_revisions" ("card");
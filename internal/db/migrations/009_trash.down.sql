@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "cards_deleted";
+DROP INDEX IF EXISTS "decks_deleted";
+
+ALTER TABLE "cards" DROP COLUMN "deleted";
+ALTER TABLE "decks" DROP COLUMN "deleted";
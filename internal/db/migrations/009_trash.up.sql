@@ -0,0 +1,7 @@
+-- When a deck or card was moved to the trash, in Unix milliseconds, NULL if it
+-- is not in the trash. Rows in the trash are purged after a retention period.
+ALTER TABLE "decks" ADD COLUMN "deleted" INTEGER DEFAULT NULL;
+ALTER TABLE "cards" ADD COLUMN "deleted" INTEGER DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS "decks_deleted" ON "decks" ("deleted");
+CREATE INDEX IF NOT EXISTS "cards_deleted" ON "cards" ("deleted");
@@ -0,0 +1,2 @@
+ALTER TABLE "cards" DROP COLUMN "buried_until";
+ALTER TABLE "cards" DROP COLUMN "suspended";
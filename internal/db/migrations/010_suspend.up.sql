@@ -0,0 +1,4 @@
+-- Suspended cards are left out of practice until unsuspended, buried cards
+-- until "buried_until" in Unix seconds
+ALTER TABLE "cards" ADD COLUMN "suspended" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "cards" ADD COLUMN "buried_until" INTEGER DEFAULT NULL;
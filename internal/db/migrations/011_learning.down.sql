@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS "cards_learning_due";
+
+ALTER TABLE "cards" DROP COLUMN "relearning";
+ALTER TABLE "cards" DROP COLUMN "learning_due";
+ALTER TABLE "cards" DROP COLUMN "learning_step";
+
+ALTER TABLE "decks" DROP COLUMN "relearning_steps";
+ALTER TABLE "decks" DROP COLUMN "learning_steps";
@@ -0,0 +1,12 @@
+-- Steps of decks as space separated durations such as "1m 10m", the defaults
+-- if NULL
+ALTER TABLE "decks" ADD COLUMN "learning_steps" TEXT DEFAULT NULL;
+ALTER TABLE "decks" ADD COLUMN "relearning_steps" TEXT DEFAULT NULL;
+
+-- Step of cards in learning or relearning, and when it is due in Unix seconds,
+-- NULL if not learning
+ALTER TABLE "cards" ADD COLUMN "learning_step" INTEGER DEFAULT NULL;
+ALTER TABLE "cards" ADD COLUMN "learning_due" INTEGER DEFAULT NULL;
+ALTER TABLE "cards" ADD COLUMN "relearning" INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS "cards_learning_due" ON "cards" ("deck", "learning_due");
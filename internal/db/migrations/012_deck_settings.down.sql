@@ -0,0 +1,3 @@
+ALTER TABLE "decks" DROP COLUMN "settings";
+
+DROP TABLE IF EXISTS "deck_settings";
@@ -0,0 +1,40 @@
+-- Settings of decks, shared by the decks which use them. An empty scheduler or
+-- direction, and NULL matching, are the defaults of the instance. "matching"
+-- is JSON. Limits of 0 are unlimited. "modified" is in Unix milliseconds.
+CREATE TABLE IF NOT EXISTS "deck_settings" (
+        "id" INTEGER
+                PRIMARY KEY
+                NOT NULL,
+        "name" TEXT
+                NOT NULL
+                UNIQUE,
+        "scheduler" TEXT
+                NOT NULL
+                DEFAULT '',
+        "direction" TEXT
+                NOT NULL
+                DEFAULT ''
+                CHECK ("direction" IN ('', 'normal', 'reverse', 'random')),
+        "matching" TEXT
+                DEFAULT NULL,
+        "order" TEXT
+                NOT NULL
+                DEFAULT 'random'
+                CHECK ("order" IN ('random', 'created')),
+        "new_limit" INTEGER
+                NOT NULL
+                DEFAULT 0
+                CHECK ("new_limit" >= 0),
+        "review_limit" INTEGER
+                NOT NULL
+                DEFAULT 0
+                CHECK ("review_limit" >= 0),
+        "modified" INTEGER
+                NOT NULL
+);
+
+INSERT INTO "deck_settings" ("id", "name", "modified")
+        VALUES (1, 'Default', CAST(strftime('%s', 'now') AS INTEGER) * 1000);
+
+-- Decks without settings use the Default settings
+ALTER TABLE "decks" ADD COLUMN "settings" INTEGER DEFAULT NULL REFERENCES "deck_settings" ("id") ON DELETE SET NULL;
@@ -0,0 +1,6 @@
+-- "content_modified" is when the front or back of a card was last edited, in
+-- Unix milliseconds, and "modified" when its practice state was. Sync keeps the
+-- latest of each apart.
+ALTER TABLE "cards" ADD COLUMN "content_modified" INTEGER NOT NULL DEFAULT 0;
+
+UPDATE "cards" SET "content_modified" = "modified";
@@ -0,0 +1,226 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultLearningSteps are the learning steps of new cards in decks
+	// without steps of their own.
+	DefaultLearningSteps = []time.Duration{time.Minute, 10 * time.Minute}
+
+	// DefaultRelearningSteps are the relearning steps of lapsed cards in
+	// decks without steps of their own.
+	DefaultRelearningSteps = []time.Duration{10 * time.Minute}
+)
+
+// Learning is the step of a card going through the learning steps of its
+// deck, or the relearning steps after a lapse. Cards leave learning when they
+// pass the last step, or when they are reviewed with ComfortReviewMax.
+type Learning struct {
+	// Index of the step in the steps of the deck
+	Step       int  `json:"step"`
+	Relearning bool `json:"relearning,omitempty"`
+
+	// When the step is due
+	Due time.Time `json:"due"`
+}
+
+// nextLearning is the learning step of a card after a review of comfort, nil if
+// it does not go through steps. before is the comfort of the card before the
+// review, -1 if it was new.
+func nextLearning(l *Learning, before, comfort float64, learning, relearning []time.Duration, now time.Time) *Learning {
+	steps := learning
+	relearn := false
+	step := 0
+	switch {
+	case l != nil:
+		if l.Relearning {
+			steps = relearning
+		}
+		relearn = l.Relearning
+		step = l.Step
+	case before == -1:
+		// New cards are at the first learning step
+	case comfort <= ComfortReviewMin:
+		// Lapsed cards start relearning
+		if len(relearning) == 0 {
+			return nil
+		}
+		return &Learning{Step: 0, Relearning: true, Due: now.Add(relearning[0])}
+	default:
+		return nil
+	}
+
+	switch {
+	case comfort <= ComfortReviewMin:
+		step = 0
+	case comfort >= ComfortReviewMax:
+		return nil
+	default:
+		step++
+	}
+	if step >= len(steps) {
+		return nil
+	}
+	return &Learning{Step: step, Relearning: relearn, Due: now.Add(steps[step])}
+}
+
+// nullLearning is the column values of a learning step.
+func nullLearning(l *Learning) (step, due sql.NullInt64, relearning bool) {
+	if l == nil {
+		return step, due, false
+	}
+	step = sql.NullInt64{Int64: int64(l.Step), Valid: true}
+	due = sql.NullInt64{Int64: l.Due.Unix(), Valid: true}
+	return step, due, l.Relearning
+}
+
+// scanLearning is the learning step of column values, nil if NULL.
+func scanLearning(step, due sql.NullInt64, relearning bool) *Learning {
+	if !step.Valid || !due.Valid {
+		return nil
+	}
+	return &Learning{
+		Step:       int(step.Int64),
+		Relearning: relearning,
+		Due:        time.Unix(due.Int64, 0),
+	}
+}
+
+// ParseSteps parses space separated durations such as "1m 10m 1h".
+func ParseSteps(s string) ([]time.Duration, error) {
+	steps := []time.Duration{}
+	for _, field := range strings.Fields(s) {
+		d, err := time.ParseDuration(field)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("trana: step %s is not positive", field)
+		}
+		steps = append(steps, d)
+	}
+	return steps, nil
+}
+
+// FormatSteps is the inverse of ParseSteps.
+func FormatSteps(steps []time.Duration) string {
+	var fields []string
+	for _, d := range steps {
+		s := d.String()
+		if strings.HasSuffix(s, "m0s") {
+			s = strings.TrimSuffix(s, "0s")
+		}
+		if strings.HasSuffix(s, "h0m") {
+			s = strings.TrimSuffix(s, "0m")
+		}
+		fields = append(fields, s)
+	}
+	return strings.Join(fields, " ")
+}
+
+// nullSteps is the column value of steps, NULL for the defaults.
+func nullSteps(steps []time.Duration) sql.NullString {
+	if steps == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: FormatSteps(steps), Valid: true}
+}
+
+// scanSteps is the steps of a column value, defaults if NULL.
+func scanSteps(s sql.NullString, defaults []time.Duration) []time.Duration {
+	if !s.Valid {
+		return defaults
+	}
+	steps, err := ParseSteps(s.String)
+	if err != nil {
+		return defaults
+	}
+	return steps
+}
+
+// SetLearningSteps sets the learning and relearning steps of a deck. Nil steps
+// are the defaults, empty steps skip learning or relearning.
+func (t *Trana) SetLearningSteps(ctx context.Context, deck int64, learning, relearning []time.Duration) error {
+	now := time.Now().UnixMilli()
+
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE "decks"
+			SET "learning_steps" = @learning, "relearning_steps" = @relearning, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`, nullSteps(learning), nullSteps(relearning), now, deck)
+		return err
+	})
+}
+
+// PracticeCounts counts the cards of a deck left to practice now.
+type PracticeCounts struct {
+	// Cards not yet practiced
+	New int
+
+	// Cards in learning or relearning whose step is due
+	Learning int
+
+	// Other cards due for review
+	Review int
+}
+
+// PracticeCounts reports the cards of a deck which NextCard may return,
+// leaving out suspended and buried cards, and cards over the daily limits of
+// the deck.
+func (t *Trana) PracticeCounts(ctx context.Context, deck int64) (*PracticeCounts, error) {
+	var counts PracticeCounts
+	var newLeft, reviewsLeft int
+	now := time.Now()
+
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		settings, err := getDeckSettings(tx, deck)
+		if err != nil {
+			return err
+		}
+		newLeft, reviewsLeft, err = t.limitsLeft(tx, deck, settings, now)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`SELECT "comfort", "last_practiced", "learning_due"
+			FROM "cards"
+			WHERE "deck" = @deck AND `+practiceCards, deck, now.Unix())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var comfort float64
+			var lastPracticed, due sql.NullInt64
+			if err = rows.Scan(&comfort, &lastPracticed, &due); err != nil {
+				return err
+			}
+			switch {
+			case due.Valid:
+				if due.Int64 <= now.Unix() {
+					counts.Learning++
+				}
+			case comfort == -1 || !lastPracticed.Valid:
+				counts.New++
+			case !time.Unix(lastPracticed.Int64, 0).Add(dueAfter(comfort)).After(now):
+				counts.Review++
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if newLeft >= 0 && counts.New > newLeft {
+		counts.New = newLeft
+	}
+	if reviewsLeft >= 0 && counts.Review > reviewsLeft {
+		counts.Review = reviewsLeft
+	}
+	return &counts, nil
+}
@@ -0,0 +1,82 @@
+package trana
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextLearning(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	learning := []time.Duration{time.Minute, 10 * time.Minute}
+	relearning := []time.Duration{10 * time.Minute}
+
+	testcases := map[string]struct {
+		l          *Learning
+		before     float64
+		comfort    float64
+		relearning []time.Duration
+		want       *Learning
+	}{
+		"new card": {
+			before:  -1,
+			comfort: 2,
+			want:    &Learning{Step: 1, Due: now.Add(10 * time.Minute)},
+		},
+		"new card forgotten": {
+			before:  -1,
+			comfort: ComfortReviewMin,
+			want:    &Learning{Step: 0, Due: now.Add(time.Minute)},
+		},
+		"new card known": {
+			before:  -1,
+			comfort: ComfortReviewMax,
+		},
+		"last step passed": {
+			l:       &Learning{Step: 1},
+			before:  2,
+			comfort: 2,
+		},
+		"step failed": {
+			l:       &Learning{Step: 1},
+			before:  2,
+			comfort: ComfortReviewMin,
+			want:    &Learning{Step: 0, Due: now.Add(time.Minute)},
+		},
+		"lapse": {
+			before:  3,
+			comfort: ComfortReviewMin,
+			want:    &Learning{Step: 0, Relearning: true, Due: now.Add(10 * time.Minute)},
+		},
+		"lapse without relearning steps": {
+			before:     3,
+			comfort:    ComfortReviewMin,
+			relearning: []time.Duration{},
+		},
+		"relearning passed": {
+			l:       &Learning{Step: 0, Relearning: true},
+			before:  ComfortReviewMin,
+			comfort: 2,
+		},
+		"review": {
+			before:  2,
+			comfort: 2.5,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			steps := relearning
+			if tc.relearning != nil {
+				steps = tc.relearning
+			}
+			got := nextLearning(tc.l, tc.before, tc.comfort, learning, steps, now)
+			switch {
+			case got == nil && tc.want == nil:
+			case got == nil || tc.want == nil:
+				t.Fatalf("got %+v; want %+v", got, tc.want)
+			case got.Step != tc.want.Step || got.Relearning != tc.want.Relearning || !got.Due.Equal(tc.want.Due):
+				t.Fatalf("got %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
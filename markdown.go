@@ -0,0 +1,44 @@
+package trana
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	">", `\>`,
+	"#", `\#`,
+	"|", `\|`,
+	"\r\n", "<br>",
+	"\n", "<br>",
+)
+
+// WriteMarkdown writes cards under a heading with the deck name, as a table
+// or, if list is set, as a definition list.
+func WriteMarkdown(w io.Writer, deck string, cards []Card, list bool) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# " + markdownEscaper.Replace(deck) + "\n\n")
+	if list {
+		for _, card := range cards {
+			bw.WriteString(markdownEscaper.Replace(card.Front) + "\n")
+			bw.WriteString(": " + markdownEscaper.Replace(card.Back) + "\n\n")
+		}
+	} else {
+		bw.WriteString("| Front | Back | Tags |\n")
+		bw.WriteString("| --- | --- | --- |\n")
+		for _, card := range cards {
+			bw.WriteString("| " + markdownEscaper.Replace(card.Front) +
+				" | " + markdownEscaper.Replace(card.Back) +
+				" | " + markdownEscaper.Replace(strings.Join(card.Tags, " ")) + " |\n")
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,123 @@
+package trana
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Matching controls how an answer is compared to the back of a card. The zero
+// value compares answers case-insensitively and otherwise exactly.
+type Matching struct {
+	CaseSensitive     bool `json:"case_sensitive"`
+	IgnoreWhitespace  bool `json:"ignore_whitespace"`
+	IgnorePunctuation bool `json:"ignore_punctuation"`
+	IgnoreDiacritics  bool `json:"ignore_diacritics"`
+}
+
+// Normalize removes the parts of s which are ignored when matching. Case is
+// kept, see Equal.
+func (m *Matching) Normalize(s string) string {
+	if m.IgnoreDiacritics {
+		var b strings.Builder
+		for _, r := range norm.NFD.String(s) {
+			if !unicode.Is(unicode.Mn, r) {
+				b.WriteRune(r)
+			}
+		}
+		s = norm.NFC.String(b.String())
+	}
+	if m.IgnorePunctuation {
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if m.IgnoreWhitespace {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	return s
+}
+
+// Equal reports whether the answer got matches want. If want has several
+// lines, each is an alternative answer.
+func (m *Matching) Equal(got, want string) bool {
+	_, ok := m.match(got, want)
+	return ok
+}
+
+// match returns the alternative of want matching got, or the first
+// alternative if none matches.
+func (m *Matching) match(got, want string) (string, bool) {
+	alts := alternatives(want)
+	got = m.Normalize(got)
+	for _, alt := range alts {
+		if m.equal(got, m.Normalize(alt)) {
+			return alt, true
+		}
+	}
+	return alts[0], false
+}
+
+func (m *Matching) equal(got, want string) bool {
+	if m.CaseSensitive {
+		return got == want
+	}
+	return strings.EqualFold(got, want)
+}
+
+// alternatives splits the back of a card into its alternative answers.
+func alternatives(back string) []string {
+	var alts []string
+	for _, line := range strings.Split(back, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			alts = append(alts, line)
+		}
+	}
+	if len(alts) == 0 {
+		return []string{back}
+	}
+	return alts
+}
+
+// equalRune reports whether two runes of normalized strings match.
+func (m *Matching) equalRune(got, want rune) bool {
+	if m.CaseSensitive {
+		return got == want
+	}
+	return strings.EqualFold(string(got), string(want))
+}
+
+type LetterDiff struct {
+	R  string
+	Ok bool
+}
+
+// Check reports whether the answer got matches want, and diffs the normalized
+// answer against the matching alternative of want letter by letter. Letters
+// missing from the answer are shown as fill.
+func (m *Matching) Check(got, want string, fill rune) (bool, []LetterDiff) {
+	alt, ok := m.match(got, want)
+	return ok, m.diff(m.Normalize(got), m.Normalize(alt), fill)
+}
+
+func (m *Matching) diff(got, want string, fill rune) []LetterDiff {
+	var diff []LetterDiff
+	gotRunes := []rune(got)
+	wantRunes := []rune(want)
+
+	for len(gotRunes) < len(wantRunes) {
+		gotRunes = append(gotRunes, fill)
+	}
+
+	for i := range gotRunes {
+		diff = append(diff, LetterDiff{
+			R:  string(gotRunes[i]),
+			Ok: i < len(wantRunes) && m.equalRune(gotRunes[i], wantRunes[i]),
+		})
+	}
+	return diff
+}
@@ -0,0 +1,101 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RevisionSource is what changed a card.
+type RevisionSource string
+
+const (
+	// The web interface
+	RevisionUI RevisionSource = "ui"
+
+	// Callers of UpdateCard, such as the command line
+	RevisionAPI RevisionSource = "api"
+
+	RevisionImport  RevisionSource = "import"
+	RevisionSync    RevisionSource = "sync"
+	RevisionRestore RevisionSource = "restore"
+)
+
+// Revision is a change of the front or back of a card.
+type Revision struct {
+	ID     int64
+	Card   int64
+	Time   time.Time
+	Source RevisionSource
+
+	OldFront, OldBack string
+	NewFront, NewBack string
+}
+
+// reviseQuery records the change of the front and back of a card, if any,
+// before it is written.
+const reviseQuery = `INSERT INTO "card_revisions" ("card", "time", "source", "old_front", "old_back", "new_front", "new_back")
+	SELECT "id", @time, @source, "front", "back", @front, @back
+	FROM "cards"
+	WHERE "id" = @card AND ("front" != @front OR "back" != @back)`
+
+// reviseCard runs reviseQuery. now is in Unix milliseconds.
+func reviseCard(tx *sql.Tx, card int64, front, back string, source RevisionSource, now int64) error {
+	_, err := tx.Exec(reviseQuery, now, source, front, back, card)
+	return err
+}
+
+// CardRevisions lists the changes of the front and back of a card, newest
+// first. Revisions are kept in this collection only and are not synced.
+func (t *Trana) CardRevisions(ctx context.Context, card int64) ([]Revision, error) {
+	var revisions []Revision
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT "id", "card", "time", "source", "old_front", "old_back", "new_front", "new_back"
+			FROM "card_revisions"
+			WHERE "card" = @card
+			ORDER BY "time" DESC, "id" DESC`, card)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r Revision
+			var unix int64
+			if err = rows.Scan(&r.ID, &r.Card, &unix, &r.Source, &r.OldFront, &r.OldBack, &r.NewFront, &r.NewBack); err != nil {
+				return err
+			}
+			r.Time = time.UnixMilli(unix)
+			revisions = append(revisions, r)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// RestoreCardRevision rolls the front and back of a card back to before the
+// revision, recording the change as a revision of its own. It returns
+// sql.ErrNoRows if the revision does not exist.
+func (t *Trana) RestoreCardRevision(ctx context.Context, id int64) error {
+	now := time.Now().UnixMilli()
+
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		var card int64
+		var front, back string
+		err := tx.QueryRow(`SELECT "card", "old_front", "old_back"
+			FROM "card_revisions"
+			WHERE "id" = @id`, id).Scan(&card, &front, &back)
+		if err != nil {
+			return err
+		}
+		if err = reviseCard(tx, card, front, back, RevisionRestore, now); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "front" = @front, "back" = @back, "content_modified" = @now, "changed" = @now
+			WHERE "id" = @id`, front, back, now, card)
+		return err
+	})
+}
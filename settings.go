@@ -0,0 +1,277 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrBadSettings = errors.New("trana: invalid deck settings")
+
+// Direction is which side of cards is asked for in practice.
+type Direction string
+
+const (
+	DirectionNormal  Direction = "normal"
+	DirectionReverse Direction = "reverse"
+	DirectionRandom  Direction = "random"
+)
+
+func (d Direction) Valid() bool {
+	switch d {
+	case DirectionNormal, DirectionReverse, DirectionRandom:
+		return true
+	default:
+		return false
+	}
+}
+
+// Order chooses between cards which the scheduler ranks the same.
+type Order string
+
+const (
+	OrderRandom  Order = "random"
+	OrderCreated Order = "created"
+)
+
+func (o Order) Valid() bool {
+	return o == OrderRandom || o == OrderCreated
+}
+
+// DeckSettings are settings of practice which decks share.
+type DeckSettings struct {
+	ID   int64
+	Name string
+
+	// Empty for Options.Scheduler
+	Scheduler Scheduler
+
+	// Empty for the default of the caller
+	Direction Direction
+
+	// Nil for the default of the caller
+	Matching *Matching
+
+	Order Order
+
+	// Cards practiced for the first time and reviews in a day, 0 for no
+	// limit. Due learning steps are not limited.
+	NewLimit    int
+	ReviewLimit int
+
+	// Number of decks using the settings
+	Decks int
+}
+
+func (s *DeckSettings) valid() bool {
+	return cleanString(s.Name) != "" &&
+		(s.Scheduler == "" || s.Scheduler.Valid()) &&
+		(s.Direction == "" || s.Direction.Valid()) &&
+		s.Order.Valid() && s.NewLimit >= 0 && s.ReviewLimit >= 0
+}
+
+// settingsColumns are the columns of settings and the number of decks using
+// them. Decks without settings use the Default settings, of ID 1.
+const settingsColumns = `"deck_settings"."id", "deck_settings"."name", "scheduler", "direction", "matching", "order", "new_limit", "review_limit", (
+	SELECT COUNT(*)
+	FROM "decks"
+	WHERE COALESCE("settings", 1) = "deck_settings"."id" AND "deleted" IS NULL
+)`
+
+func scanSettings(s scanner, settings *DeckSettings) error {
+	var matching sql.NullString
+	err := s.Scan(&settings.ID, &settings.Name, &settings.Scheduler, &settings.Direction, &matching, &settings.Order, &settings.NewLimit, &settings.ReviewLimit, &settings.Decks)
+	if err != nil {
+		return err
+	}
+	settings.Matching = nil
+	if matching.Valid {
+		settings.Matching = &Matching{}
+		return json.Unmarshal([]byte(matching.String), settings.Matching)
+	}
+	return nil
+}
+
+func nullMatching(m *Matching) (sql.NullString, error) {
+	if m == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+func getDeckSettings(tx *sql.Tx, deck int64) (*DeckSettings, error) {
+	var settings DeckSettings
+	err := scanSettings(tx.QueryRow(`SELECT `+settingsColumns+`
+		FROM "deck_settings"
+		JOIN "decks" ON COALESCE("decks"."settings", 1) = "deck_settings"."id"
+		WHERE "decks"."id" = @deck`, deck), &settings)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// GetDeckSettings returns the settings used by a deck.
+func (t *Trana) GetDeckSettings(ctx context.Context, deck int64) (*DeckSettings, error) {
+	var settings *DeckSettings
+	err := t.db.Tx(ctx, func(tx *sql.Tx) (err error) {
+		settings, err = getDeckSettings(tx, deck)
+		return err
+	})
+	return settings, err
+}
+
+// ListDeckSettings returns all settings, to choose from for a deck.
+func (t *Trana) ListDeckSettings(ctx context.Context) ([]DeckSettings, error) {
+	var list []DeckSettings
+	err := t.db.Tx(ctx, func(tx *sql.Tx) (err error) {
+		list, err = listDeckSettings(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func listDeckSettings(tx *sql.Tx) ([]DeckSettings, error) {
+	rows, err := tx.Query(`SELECT ` + settingsColumns + `
+		FROM "deck_settings"
+		ORDER BY "deck_settings"."id" ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []DeckSettings{}
+	for rows.Next() {
+		var settings DeckSettings
+		if err = scanSettings(rows, &settings); err != nil {
+			return nil, err
+		}
+		list = append(list, settings)
+	}
+	return list, rows.Err()
+}
+
+// CreateDeckSettings adds settings with the fields of settings, which decks may
+// then use with UseDeckSettings. Names are unique.
+func (t *Trana) CreateDeckSettings(ctx context.Context, settings *DeckSettings) (int64, error) {
+	if !settings.valid() {
+		return 0, ErrBadSettings
+	}
+	matching, err := nullMatching(settings.Matching)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = t.db.Tx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO "deck_settings" ("name", "scheduler", "direction", "matching", "order", "new_limit", "review_limit", "modified")
+			VALUES (@name, @scheduler, @direction, @matching, @order, @newLimit, @reviewLimit, @now)`,
+			cleanString(settings.Name), settings.Scheduler, settings.Direction, matching, settings.Order, settings.NewLimit, settings.ReviewLimit, time.Now().UnixMilli())
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	return id, err
+}
+
+// UpdateDeckSettings writes settings, changing them for every deck using them.
+// It returns sql.ErrNoRows if the settings do not exist.
+func (t *Trana) UpdateDeckSettings(ctx context.Context, settings *DeckSettings) error {
+	if !settings.valid() {
+		return ErrBadSettings
+	}
+	matching, err := nullMatching(settings.Matching)
+	if err != nil {
+		return err
+	}
+
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE "deck_settings"
+			SET "name" = @name, "scheduler" = @scheduler, "direction" = @direction, "matching" = @matching, "order" = @order, "new_limit" = @newLimit, "review_limit" = @reviewLimit, "modified" = @now
+			WHERE "id" = @id`,
+			cleanString(settings.Name), settings.Scheduler, settings.Direction, matching, settings.Order, settings.NewLimit, settings.ReviewLimit, time.Now().UnixMilli(), settings.ID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// UseDeckSettings makes a deck use settings.
+func (t *Trana) UseDeckSettings(ctx context.Context, deck, settings int64) error {
+	now := time.Now().UnixMilli()
+
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE "decks"
+			SET "settings" = @settings, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`, settings, now, deck)
+		return err
+	})
+}
+
+// practicedToday counts the cards of a deck practiced for the first time today,
+// and all reviews of its cards today.
+func (t *Trana) practicedToday(tx *sql.Tx, deck int64, now time.Time) (newCards, reviews int, err error) {
+	today := t.day(now).Unix()
+	err = tx.QueryRow(`SELECT COUNT(*)
+		FROM "reviews"
+		JOIN "cards" ON "cards"."id" = "reviews"."card"
+		WHERE "deck" = @deck AND "time" >= @today`, deck, today).Scan(&reviews)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = tx.QueryRow(`SELECT COUNT(*)
+		FROM (
+			SELECT MIN("time") AS "first"
+			FROM "reviews"
+			JOIN "cards" ON "cards"."id" = "reviews"."card"
+			WHERE "deck" = @deck
+			GROUP BY "card"
+		)
+		WHERE "first" >= @today`, deck, today).Scan(&newCards)
+	return newCards, reviews, err
+}
+
+// limitsLeft is how many new cards and reviews are left today in a deck, -1 if
+// unlimited.
+func (t *Trana) limitsLeft(tx *sql.Tx, deck int64, settings *DeckSettings, now time.Time) (newCards, reviews int, err error) {
+	newCards, reviews = -1, -1
+	if settings.NewLimit == 0 && settings.ReviewLimit == 0 {
+		return newCards, reviews, nil
+	}
+	newToday, reviewsToday, err := t.practicedToday(tx, deck, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	if settings.NewLimit > 0 {
+		newCards = max0(settings.NewLimit - newToday)
+	}
+	if settings.ReviewLimit > 0 {
+		reviews = max0(settings.ReviewLimit - reviewsToday)
+	}
+	return newCards, reviews, nil
+}
+
+func max0(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
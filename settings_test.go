@@ -0,0 +1,83 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestDailyLimits(t *testing.T) {
+	const cards, tries = 5, 10
+
+	testcases := map[string]struct {
+		newLimit    int
+		reviewLimit int
+
+		// New cards counted before practice
+		counted int
+
+		// Cards picked before NextCard runs out, and how many were new
+		picked   int
+		newCards int
+	}{
+		"no limits":    {counted: 5, picked: tries, newCards: 5},
+		"new limit":    {newLimit: 2, counted: 2, picked: tries, newCards: 2},
+		"review limit": {reviewLimit: 3, counted: 5, picked: 3, newCards: 3},
+		"both limits":  {newLimit: 2, reviewLimit: 4, counted: 2, picked: 4, newCards: 2},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			tr := newTestTrana(t)
+			deck := newTestDeck(t, tr, cards)
+			settings, err := tr.CreateDeckSettings(ctx, &DeckSettings{
+				Name:        "Limited",
+				Order:       OrderCreated,
+				NewLimit:    tc.newLimit,
+				ReviewLimit: tc.reviewLimit,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = tr.UseDeckSettings(ctx, deck, settings); err != nil {
+				t.Fatal(err)
+			}
+
+			counts, err := tr.PracticeCounts(ctx, deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counts.New != tc.counted {
+				t.Errorf("counted %d new cards; want %d", counts.New, tc.counted)
+			}
+
+			picked, newCards := 0, 0
+			for ; picked < tries; picked++ {
+				card, err := tr.NextCard(ctx, deck)
+				if errors.Is(err, sql.ErrNoRows) {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				if card.Comfort == -1 {
+					newCards++
+				}
+				if _, err = tr.ReviewCard(ctx, card.ID, ComfortReviewMax, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if picked != tc.picked || newCards != tc.newCards {
+				t.Errorf("picked %d cards, %d new; want %d, %d new", picked, newCards, tc.picked, tc.newCards)
+			}
+
+			if counts, err = tr.PracticeCounts(ctx, deck); err != nil {
+				t.Fatal(err)
+			}
+			if want := tc.counted - tc.newCards; counts.New != want {
+				t.Errorf("counted %d new cards after practice; want %d", counts.New, want)
+			}
+		})
+	}
+}
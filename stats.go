@@ -0,0 +1,328 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+)
+
+const (
+	// StatsDays is the number of days of reviews in Stats.
+	StatsDays = 30
+
+	// StatsForecastDays is the number of days of due cards in Stats.
+	StatsForecastDays = 14
+
+	statsHardest = 10
+)
+
+// ComfortBucket counts the cards with comfort from Min to below Max.
+type ComfortBucket struct {
+	Label    string
+	Min, Max float64
+	Cards    int
+}
+
+// comfortBuckets match the comfort badges of the card list.
+var comfortBuckets = []ComfortBucket{
+	{Label: "Not practiced", Min: -1, Max: ComfortMin},
+	{Label: "Not sure", Min: ComfortMin, Max: 1.5},
+	{Label: "Learning", Min: 1.5, Max: 3},
+	{Label: "Confident", Min: 3, Max: ComfortMax + 1},
+}
+
+// DayStats are the reviews of one day.
+type DayStats struct {
+	Date    time.Time
+	Reviews int
+
+	// Reviews whose answer was checked, and those which were correct
+	Checked int
+	Correct int
+}
+
+// Accuracy is the fraction of checked reviews which were correct, -1 if none
+// were checked.
+func (d *DayStats) Accuracy() float64 {
+	if d.Checked == 0 {
+		return -1
+	}
+	return float64(d.Correct) / float64(d.Checked)
+}
+
+// HardCard is a card often reviewed as not sure.
+type HardCard struct {
+	Card    Card
+	Reviews int
+	Lapses  int
+}
+
+type Stats struct {
+	Cards   int
+	Reviews int
+
+	Comfort []ComfortBucket
+
+	// The last StatsDays days up to today, oldest first
+	Days []DayStats
+
+	// Average time taken to answer, 0 if unknown
+	AverageDuration time.Duration
+
+	// Cards with the most reviews of comfort ComfortReviewMin
+	Hardest []HardCard
+
+	// Cards due in each of the next StatsForecastDays days, today first.
+	// Today includes overdue cards. Cards not yet practiced are not due.
+	Forecast []int
+}
+
+// Stats reports the progress of practice in a deck, or in all decks if deck
+// is 0. Days are in the time zone of Options.Location.
+func (t *Trana) Stats(ctx context.Context, deck int64) (*Stats, error) {
+	today := t.day(time.Now())
+	start := today.AddDate(0, 0, 1-StatsDays)
+
+	stats := Stats{
+		Comfort:  append([]ComfortBucket(nil), comfortBuckets...),
+		Days:     make([]DayStats, StatsDays),
+		Forecast: make([]int, StatsForecastDays),
+	}
+	for i := range stats.Days {
+		stats.Days[i].Date = start.AddDate(0, 0, i)
+	}
+
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		if err := statsCards(tx, deck, today, &stats); err != nil {
+			return err
+		}
+		if err := statsReviews(tx, deck, start, &stats); err != nil {
+			return err
+		}
+		return statsHardCards(tx, deck, &stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func statsCards(tx *sql.Tx, deck int64, today time.Time, stats *Stats) error {
+	rows, err := tx.Query(`SELECT "comfort", "last_practiced"
+		FROM "cards"
+		WHERE (@deck = 0 OR "deck" = @deck) AND `+liveCards, deck)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var comfort float64
+		var lastPracticed sql.NullInt64
+		if err = rows.Scan(&comfort, &lastPracticed); err != nil {
+			return err
+		}
+		stats.Cards++
+		for i := range stats.Comfort {
+			if comfort >= stats.Comfort[i].Min && comfort < stats.Comfort[i].Max {
+				stats.Comfort[i].Cards++
+				break
+			}
+		}
+
+		if comfort == -1 || !lastPracticed.Valid {
+			continue
+		}
+		due := time.Unix(lastPracticed.Int64, 0).Add(dueAfter(comfort))
+		day := 0
+		if due.After(today) {
+			day = int(due.Sub(today).Hours() / 24)
+		}
+		if day < len(stats.Forecast) {
+			stats.Forecast[day]++
+		}
+	}
+	return rows.Err()
+}
+
+func statsReviews(tx *sql.Tx, deck int64, start time.Time, stats *Stats) error {
+	var duration float64
+	err := tx.QueryRow(`SELECT COUNT(*), COALESCE(AVG("duration"), 0)
+		FROM "reviews"
+		JOIN "cards" ON "cards"."id" = "reviews"."card"
+		WHERE (@deck = 0 OR "deck" = @deck) AND `+liveCards, deck).Scan(&stats.Reviews, &duration)
+	if err != nil {
+		return err
+	}
+	stats.AverageDuration = time.Duration(duration * float64(time.Millisecond))
+
+	rows, err := tx.Query(`SELECT "time", "correct"
+		FROM "reviews"
+		JOIN "cards" ON "cards"."id" = "reviews"."card"
+		WHERE "time" >= @start AND (@deck = 0 OR "deck" = @deck) AND `+liveCards, start.Unix(), deck)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var unix int64
+		var correct sql.NullBool
+		if err = rows.Scan(&unix, &correct); err != nil {
+			return err
+		}
+		t := time.Unix(unix, 0)
+		i := 0
+		for i+1 < len(stats.Days) && !t.Before(stats.Days[i+1].Date) {
+			i++
+		}
+		day := &stats.Days[i]
+		day.Reviews++
+		if correct.Valid {
+			day.Checked++
+			if correct.Bool {
+				day.Correct++
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func statsHardCards(tx *sql.Tx, deck int64, stats *Stats) error {
+	rows, err := tx.Query(`SELECT `+cardColumns+`, "reviews", "lapses"
+		FROM "cards"
+		JOIN (
+			SELECT "card", COUNT(*) AS "reviews", SUM("comfort" = @lapse) AS "lapses"
+			FROM "reviews"
+			GROUP BY "card"
+		) ON "card" = "id"
+		WHERE "lapses" > 0 AND (@deck = 0 OR "deck" = @deck) AND `+liveCards+`
+		ORDER BY "lapses" DESC, "comfort" ASC
+		LIMIT @limit`, ComfortReviewMin, deck, statsHardest)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hard HardCard
+		if err = scanCard(scanExtra{rows, []any{&hard.Reviews, &hard.Lapses}}, &hard.Card); err != nil {
+			return err
+		}
+		stats.Hardest = append(stats.Hardest, hard)
+	}
+	return rows.Err()
+}
+
+// ActivityWeeks is the number of weeks of days in Activity.
+const ActivityWeeks = 53
+
+// ActivityDay is the number of reviews in one day.
+type ActivityDay struct {
+	Date    time.Time
+	Reviews int
+}
+
+// Activity is the review history of all decks by day, and the streaks of
+// days on which the daily goal was met.
+type Activity struct {
+	// Days from the Sunday ActivityWeeks-1 weeks before the current week
+	// up to today, oldest first
+	Days []ActivityDay
+
+	// Reviews in a day which meet the daily goal
+	Goal int
+
+	// Reviews today
+	Today int
+
+	// Days in a row up to today on which the goal was met. Today only
+	// counts once the goal is met, so the streak is not broken before the
+	// day is over.
+	Streak int
+
+	// Most days in a row on which the goal was met
+	LongestStreak int
+}
+
+// Activity reports reviews per day and streaks for the daily goal of at least
+// goal reviews. Days are in the time zone of Options.Location.
+func (t *Trana) Activity(ctx context.Context, goal int) (*Activity, error) {
+	if goal < 1 {
+		goal = 1
+	}
+	today := t.day(time.Now())
+	start := today.AddDate(0, 0, -int(today.Weekday())-7*(ActivityWeeks-1))
+
+	a := Activity{Goal: goal}
+	for d := start; !d.After(today); d = d.AddDate(0, 0, 1) {
+		a.Days = append(a.Days, ActivityDay{Date: d})
+	}
+
+	// Last day on which the goal was met, and the streak up to it
+	var met time.Time
+	var streak int
+	addDay := func(day time.Time, reviews int) {
+		if reviews == 0 {
+			return
+		}
+		if !day.Before(start) && !day.After(today) {
+			i := int(math.Round(day.Sub(start).Hours() / 24))
+			a.Days[i].Reviews = reviews
+		}
+		if reviews < goal {
+			return
+		}
+		if met.AddDate(0, 0, 1).Equal(day) {
+			streak++
+		} else {
+			streak = 1
+		}
+		met = day
+		if streak > a.LongestStreak {
+			a.LongestStreak = streak
+		}
+	}
+
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT "time" FROM "reviews" ORDER BY "time"`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var day time.Time
+		var reviews int
+		for rows.Next() {
+			var unix int64
+			if err = rows.Scan(&unix); err != nil {
+				return err
+			}
+			if d := t.day(time.Unix(unix, 0)); !d.Equal(day) {
+				addDay(day, reviews)
+				day, reviews = d, 0
+			}
+			reviews++
+		}
+		addDay(day, reviews)
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.Today = a.Days[len(a.Days)-1].Reviews
+	if met.Equal(today) || met.Equal(today.AddDate(0, 0, -1)) {
+		a.Streak = streak
+	}
+	return &a, nil
+}
+
+// day is the start of the day of tm.
+func (t *Trana) day(tm time.Time) time.Time {
+	y, m, d := tm.In(t.location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.location)
+}
+
+// dueAfter is how long after practice a card of the comfort is due again,
+// the review interval of its Anki export.
+func dueAfter(comfort float64) time.Duration {
+	return time.Duration(ankiInterval(comfort)) * 24 * time.Hour
+}
@@ -0,0 +1,135 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	yes, no := true, false
+
+	// A review at a time from the start of today in Options.Location
+	type review struct {
+		card    int
+		at      time.Duration
+		comfort float64
+		correct *bool
+		dur     time.Duration
+	}
+	const day = 24 * time.Hour
+
+	testcases := map[string]struct {
+		location *time.Location
+		reviews  []review
+
+		// Reviews, checked and correct reviews by days before today
+		days     map[int][3]int
+		total    int
+		accuracy map[int]float64
+		duration time.Duration
+
+		// Lapses of the hardest card
+		lapses int
+	}{
+		"no reviews": {
+			accuracy: map[int]float64{0: -1},
+		},
+		"days": {
+			reviews: []review{
+				{card: 0, at: time.Hour, comfort: ComfortReviewMin, correct: &no, dur: 4 * time.Second},
+				{card: 1, at: 2 * time.Hour, comfort: 3, correct: &yes, dur: 2 * time.Second},
+				{card: 0, at: -2*day + time.Hour, comfort: ComfortReviewMin, correct: &yes},
+				{card: 1, at: -2*day + 2*time.Hour, comfort: 3},
+				{card: 0, at: -40 * day, comfort: 2, correct: &yes},
+			},
+			days:     map[int][3]int{0: {2, 2, 1}, 2: {2, 1, 1}},
+			total:    5,
+			accuracy: map[int]float64{0: 0.5, 1: -1, 2: 1},
+			duration: 3 * time.Second,
+			lapses:   2,
+		},
+		"start of the day in the location": {
+			location: time.FixedZone("UTC-5", -5*60*60),
+			reviews: []review{
+				{card: 0, at: time.Minute, comfort: 3},
+				{card: 0, at: -time.Minute, comfort: 3},
+				{card: 1, at: -day, comfort: 3},
+			},
+			days:  map[int][3]int{0: {1, 0, 0}, 1: {2, 0, 0}},
+			total: 3,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			location := tc.location
+			if location == nil {
+				location = time.UTC
+			}
+			tr, err := New(":memory:", &Options{Location: location})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tr.Close()
+			deck := newTestDeck(t, tr, 2)
+			cards, err := tr.ListCards(ctx, deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			today := tr.day(time.Now())
+			err = tr.db.Tx(ctx, func(tx *sql.Tx) error {
+				for _, r := range tc.reviews {
+					_, err := insertReview(tx, cards[r.card].ID, &Review{
+						Time:     today.Add(r.at),
+						Comfort:  r.comfort,
+						Correct:  r.correct,
+						Duration: r.dur,
+					}, time.Now().UnixMilli())
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err := tr.Stats(ctx, deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Cards != 2 || stats.Reviews != tc.total {
+				t.Errorf("%d cards, %d reviews; want 2, %d", stats.Cards, stats.Reviews, tc.total)
+			}
+			if len(stats.Days) != StatsDays || !stats.Days[StatsDays-1].Date.Equal(today) {
+				t.Fatalf("days %+v; want %d up to %v", stats.Days, StatsDays, today)
+			}
+			for i, d := range stats.Days {
+				ago := StatsDays - 1 - i
+				if got := [3]int{d.Reviews, d.Checked, d.Correct}; got != tc.days[ago] {
+					t.Errorf("%d days ago: reviews, checked and correct %v; want %v", ago, got, tc.days[ago])
+				}
+			}
+			for ago, want := range tc.accuracy {
+				if got := stats.Days[StatsDays-1-ago].Accuracy(); got != want {
+					t.Errorf("%d days ago: accuracy %v; want %v", ago, got, want)
+				}
+			}
+			if stats.AverageDuration != tc.duration {
+				t.Errorf("average duration %v; want %v", stats.AverageDuration, tc.duration)
+			}
+			lapses := 0
+			if len(stats.Hardest) > 0 {
+				lapses = stats.Hardest[0].Lapses
+			}
+			if lapses != tc.lapses {
+				t.Errorf("hardest card has %d lapses; want %d", lapses, tc.lapses)
+			}
+		})
+	}
+}
@@ -0,0 +1,626 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrBadSync = errors.New("trana: invalid sync changes")
+
+// SyncChanges are the decks, cards, reviews and deletions written in a
+// collection since an earlier sync. Decks and cards are identified by UUID.
+type SyncChanges struct {
+	Decks      []SyncDeck      `json:"decks"`
+	Cards      []SyncCard      `json:"cards"`
+	Reviews    []SyncReview    `json:"reviews"`
+	Tombstones []SyncTombstone `json:"tombstones"`
+}
+
+func (c *SyncChanges) count() int {
+	return len(c.Decks) + len(c.Cards) + len(c.Reviews) + len(c.Tombstones)
+}
+
+type SyncDeck struct {
+	UUID     string    `json:"uuid"`
+	Name     string    `json:"name"`
+	Modified time.Time `json:"modified"`
+}
+
+type SyncCard struct {
+	UUID          string     `json:"uuid"`
+	Deck          string     `json:"deck"`
+	Front         string     `json:"front"`
+	Back          string     `json:"back"`
+	Tags          []string   `json:"tags,omitempty"`
+	LastPracticed *time.Time `json:"last_practiced,omitempty"`
+	Comfort       float64    `json:"comfort"`
+	Suspended     bool       `json:"suspended,omitempty"`
+	BuriedUntil   *time.Time `json:"buried_until,omitempty"`
+	Learning      *Learning  `json:"learning,omitempty"`
+
+	// When the front or back was edited, and when the rest was. Peers
+	// without ContentModified send only Modified.
+	ContentModified time.Time `json:"content_modified"`
+	Modified        time.Time `json:"modified"`
+}
+
+type SyncReview struct {
+	Card    string    `json:"card"`
+	Time    time.Time `json:"time"`
+	Comfort float64   `json:"comfort"`
+	Correct *bool     `json:"correct,omitempty"`
+
+	// Milliseconds taken to answer, 0 if unknown
+	Duration int64 `json:"duration,omitempty"`
+}
+
+// SyncTombstone is a deleted deck or card.
+type SyncTombstone struct {
+	UUID    string    `json:"uuid"`
+	Kind    string    `json:"kind"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// SyncRequest is sent to a peer by SyncPeer and answered by SyncServe.
+type SyncRequest struct {
+	// Changes of the peer since this time are requested
+	Since int64 `json:"since"`
+
+	Changes SyncChanges `json:"changes"`
+}
+
+type SyncResponse struct {
+	// Since of the next request
+	Now int64 `json:"now"`
+
+	Changes SyncChanges `json:"changes"`
+}
+
+type SyncResult struct {
+	Sent     int
+	Received int
+
+	// Received changes which were newer than the collection
+	Applied int
+}
+
+// SyncPeer syncs the collection with a peer, named by a URL or other string
+// which identifies it across syncs. Exchange sends the request to the peer,
+// which answers it with SyncServe.
+//
+// Sync is two-way: each side sends the changes written since the last sync
+// with the other. Decks edited on both sides keep the latest edit. Cards keep
+// the latest edit of their front and back, and apart from it the latest change
+// of their tags and practice state. Deletions win over earlier edits. Reviews
+// of both sides are kept. Deck settings are local to each collection and are
+// not synced.
+func (t *Trana) SyncPeer(ctx context.Context, peer string, exchange func(*SyncRequest) (*SyncResponse, error)) (*SyncResult, error) {
+	var sent, received int64
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`SELECT "sent", "received"
+			FROM "sync_peers"
+			WHERE "peer" = @peer`, peer).Scan(&sent, &received)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changes, now, err := t.syncChanges(ctx, sent)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := exchange(&SyncRequest{
+		Since:   received,
+		Changes: *changes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	applied, err := t.applyChanges(ctx, &resp.Changes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.db.Tx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO "sync_peers" ("peer", "sent", "received")
+			VALUES (@peer, @sent, @received)`, peer, now, resp.Now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SyncResult{
+		Sent:     changes.count(),
+		Received: resp.Changes.count(),
+		Applied:  applied,
+	}, nil
+}
+
+// SyncServe answers the request of a peer's SyncPeer. Invalid changes are
+// reported with ErrBadSync.
+func (t *Trana) SyncServe(ctx context.Context, req *SyncRequest) (*SyncResponse, error) {
+	// Changes of the request are written after now, so they are sent back
+	// on the next sync, where they are older than the peer and ignored
+	changes, now, err := t.syncChanges(ctx, req.Since)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = t.applyChanges(ctx, &req.Changes); err != nil {
+		return nil, err
+	}
+	return &SyncResponse{
+		Now:     now,
+		Changes: *changes,
+	}, nil
+}
+
+// syncChanges returns the rows changed since the time, and the time to pass
+// for the next changes. Rows changed at the time itself are returned again, in
+// case they were written after the previous call.
+func (t *Trana) syncChanges(ctx context.Context, since int64) (*SyncChanges, int64, error) {
+	changes := SyncChanges{
+		Decks:      []SyncDeck{},
+		Cards:      []SyncCard{},
+		Reviews:    []SyncReview{},
+		Tombstones: []SyncTombstone{},
+	}
+	now := time.Now().UnixMilli()
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT "uuid", "name", "modified"
+			FROM "decks"
+			WHERE "changed" >= @since AND "deleted" IS NULL
+			ORDER BY "id" ASC`, since)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var deck SyncDeck
+			var modified int64
+			if err = rows.Scan(&deck.UUID, &deck.Name, &modified); err != nil {
+				return err
+			}
+			deck.Modified = time.UnixMilli(modified)
+			changes.Decks = append(changes.Decks, deck)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(`SELECT "cards"."uuid", "decks"."uuid", "front", "back", "tags", "last_practiced", "comfort", "suspended", "buried_until", "learning_step", "learning_due", "relearning", "cards"."content_modified", "cards"."modified"
+			FROM "cards"
+			JOIN "decks" ON "decks"."id" = "cards"."deck"
+			WHERE "cards"."changed" >= @since AND "cards"."deleted" IS NULL AND "decks"."deleted" IS NULL
+			ORDER BY "cards"."id" ASC`, since)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var card SyncCard
+			var tags sql.NullString
+			var lastPracticed, buriedUntil, step, due sql.NullInt64
+			var relearning bool
+			var contentModified, modified int64
+			if err = rows.Scan(&card.UUID, &card.Deck, &card.Front, &card.Back, &tags, &lastPracticed, &card.Comfort, &card.Suspended, &buriedUntil, &step, &due, &relearning, &contentModified, &modified); err != nil {
+				return err
+			}
+			card.Learning = scanLearning(step, due, relearning)
+			card.Tags = strings.Fields(tags.String)
+			card.LastPracticed = unixTime(lastPracticed)
+			card.BuriedUntil = unixTime(buriedUntil)
+			card.ContentModified = time.UnixMilli(contentModified)
+			card.Modified = time.UnixMilli(modified)
+			changes.Cards = append(changes.Cards, card)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(`SELECT "cards"."uuid", "time", "reviews"."comfort", "correct", "duration"
+			FROM "reviews"
+			JOIN "cards" ON "cards"."id" = "reviews"."card"
+			WHERE "reviews"."changed" >= @since
+			ORDER BY "reviews"."id" ASC`, since)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var review SyncReview
+			var unix int64
+			var correct sql.NullBool
+			var duration sql.NullInt64
+			if err = rows.Scan(&review.Card, &unix, &review.Comfort, &correct, &duration); err != nil {
+				return err
+			}
+			review.Time = time.Unix(unix, 0)
+			if correct.Valid {
+				review.Correct = &correct.Bool
+			}
+			review.Duration = duration.Int64
+			changes.Reviews = append(changes.Reviews, review)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(`SELECT "uuid", "kind", "deleted"
+			FROM "tombstones"
+			WHERE "changed" >= @since`, since)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var tombstone SyncTombstone
+			var deleted int64
+			if err = rows.Scan(&tombstone.UUID, &tombstone.Kind, &deleted); err != nil {
+				return err
+			}
+			tombstone.Deleted = time.UnixMilli(deleted)
+			changes.Tombstones = append(changes.Tombstones, tombstone)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &changes, now, nil
+}
+
+// applyChanges writes the changes of a peer which are newer than the
+// collection, and returns how many were written.
+func (t *Trana) applyChanges(ctx context.Context, changes *SyncChanges) (int, error) {
+	if err := checkChanges(changes); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UnixMilli()
+	applied := 0
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		for _, deck := range changes.Decks {
+			ok, err := applyDeck(tx, &deck, now)
+			if err != nil {
+				return err
+			}
+			if ok {
+				applied++
+			}
+		}
+		for _, card := range changes.Cards {
+			ok, err := applyCard(tx, &card, now)
+			if err != nil {
+				return err
+			}
+			if ok {
+				applied++
+			}
+		}
+		for _, review := range changes.Reviews {
+			var card int64
+			err := tx.QueryRow(`SELECT "id"
+				FROM "cards"
+				WHERE "uuid" = @uuid`, review.Card).Scan(&card)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Deleted card
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			ok, err := insertReview(tx, card, &Review{
+				Time:     review.Time,
+				Comfort:  review.Comfort,
+				Correct:  review.Correct,
+				Duration: time.Duration(review.Duration) * time.Millisecond,
+			}, now)
+			if err != nil {
+				return err
+			}
+			if ok {
+				applied++
+			}
+		}
+		for _, tombstone := range changes.Tombstones {
+			ok, err := applyTombstone(tx, &tombstone, now)
+			if err != nil {
+				return err
+			}
+			if ok {
+				applied++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
+
+func checkChanges(changes *SyncChanges) error {
+	for i := range changes.Decks {
+		deck := &changes.Decks[i]
+		if deck.UUID = cleanUUID(deck.UUID); deck.UUID == "" {
+			return fmt.Errorf("%w: deck %d: invalid uuid", ErrBadSync, i)
+		}
+		deck.Name = cleanString(deck.Name)
+	}
+	for i := range changes.Cards {
+		card := &changes.Cards[i]
+		if card.UUID = cleanUUID(card.UUID); card.UUID == "" {
+			return fmt.Errorf("%w: card %d: invalid uuid", ErrBadSync, i)
+		}
+		if card.Deck = cleanUUID(card.Deck); card.Deck == "" {
+			return fmt.Errorf("%w: card %d: invalid deck uuid", ErrBadSync, i)
+		}
+		if err := validateCard(card.Front, card.Back, card.Comfort); err != nil {
+			return fmt.Errorf("%w: card %d: %v", ErrBadSync, i, err)
+		}
+		card.Front = cleanString(card.Front)
+		card.Back = cleanString(card.Back)
+		if card.ContentModified.IsZero() {
+			card.ContentModified = card.Modified
+		}
+	}
+	for i := range changes.Reviews {
+		review := &changes.Reviews[i]
+		if review.Card = cleanUUID(review.Card); review.Card == "" {
+			return fmt.Errorf("%w: review %d: invalid card uuid", ErrBadSync, i)
+		}
+		if review.Comfort < ComfortReviewMin || review.Comfort > ComfortReviewMax {
+			return fmt.Errorf("%w: review %d: %v", ErrBadSync, i, ErrBadComfort)
+		}
+	}
+	for i := range changes.Tombstones {
+		tombstone := &changes.Tombstones[i]
+		if tombstone.UUID = cleanUUID(tombstone.UUID); tombstone.UUID == "" {
+			return fmt.Errorf("%w: tombstone %d: invalid uuid", ErrBadSync, i)
+		}
+		if tombstone.Kind != "deck" && tombstone.Kind != "card" {
+			return fmt.Errorf("%w: tombstone %d: unknown kind %q", ErrBadSync, i, tombstone.Kind)
+		}
+	}
+	return nil
+}
+
+// newer reports whether an edit at modified replaces one at existing. Edits at
+// the same time are ordered by their content, so that both sides of a sync
+// keep the same one.
+func newer(modified, existing int64, content, existingContent string) bool {
+	if modified != existing {
+		return modified > existing
+	}
+	return content > existingContent
+}
+
+// buried reports whether the row was deleted at or after modified.
+func buried(tx *sql.Tx, uuid string, modified int64) (bool, error) {
+	var deleted int64
+	err := tx.QueryRow(`SELECT "deleted"
+		FROM "tombstones"
+		WHERE "uuid" = @uuid`, uuid).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return deleted >= modified, nil
+}
+
+func applyDeck(tx *sql.Tx, deck *SyncDeck, now int64) (bool, error) {
+	modified := deck.Modified.UnixMilli()
+
+	var id, existing int64
+	var name string
+	var deleted sql.NullInt64
+	err := tx.QueryRow(`SELECT "id", "name", "modified", "deleted"
+		FROM "decks"
+		WHERE "uuid" = @uuid`, deck.UUID).Scan(&id, &name, &existing, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		if ok, err := buried(tx, deck.UUID, modified); ok || err != nil {
+			return false, err
+		}
+		// Edited after it was deleted here
+		if _, err = tx.Exec(`DELETE FROM "tombstones" WHERE "uuid" = @uuid`, deck.UUID); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`INSERT INTO "decks" ("uuid", "name", "modified", "changed")
+			VALUES (@uuid, @name, @modified, @changed)`, deck.UUID, deck.Name, modified, now)
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if !newer(modified, existing, deck.Name, name) {
+		return false, nil
+	}
+	if ok, err := untrash(tx, deck.UUID, deleted, modified); !ok || err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`UPDATE "decks"
+		SET "name" = @name, "modified" = @modified, "changed" = @changed, "deleted" = NULL
+		WHERE "id" = @id`, deck.Name, modified, now, id)
+	return err == nil, err
+}
+
+func applyCard(tx *sql.Tx, card *SyncCard, now int64) (bool, error) {
+	contentModified := card.ContentModified.UnixMilli()
+	modified := card.Modified.UnixMilli()
+
+	// Latest edit of any part, to compare with deletions
+	edited := modified
+	if contentModified > edited {
+		edited = contentModified
+	}
+
+	var deck int64
+	err := tx.QueryRow(`SELECT "id"
+		FROM "decks"
+		WHERE "uuid" = @uuid`, card.Deck).Scan(&deck)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted with its deck
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var lastPracticed sql.NullInt64
+	if card.LastPracticed != nil {
+		lastPracticed.Valid = true
+		lastPracticed.Int64 = card.LastPracticed.Unix()
+	}
+	tags := joinTags(card.Tags)
+
+	var existing Card
+	var existingTags sql.NullString
+	var existingContent, existingModified int64
+	var deleted sql.NullInt64
+	err = tx.QueryRow(`SELECT "id", "front", "back", "tags", "comfort", "content_modified", "modified", "deleted"
+		FROM "cards"
+		WHERE "uuid" = @uuid`, card.UUID).Scan(&existing.ID, &existing.Front, &existing.Back, &existingTags, &existing.Comfort, &existingContent, &existingModified, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		if ok, err := buried(tx, card.UUID, edited); ok || err != nil {
+			return false, err
+		}
+		if _, err = tx.Exec(`DELETE FROM "tombstones" WHERE "uuid" = @uuid`, card.UUID); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`INSERT INTO "cards" ("uuid", "deck", "front", "back", "tags", "last_practiced", "comfort", "content_modified", "modified", "changed")
+			VALUES (@uuid, @deck, @front, @back, @tags, @lastPracticed, @comfort, @contentModified, @modified, @changed)`,
+			card.UUID, deck, card.Front, card.Back, tags, lastPracticed, card.Comfort, contentModified, modified, now)
+		if err != nil {
+			return false, err
+		}
+		return true, applyCardState(tx, card)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The content and the rest of the card are resolved apart, so that an
+	// edit on one side and a review on the other are both kept
+	content := newer(contentModified, existingContent, card.Front+"\n"+card.Back, existing.Front+"\n"+existing.Back)
+	state := newer(modified, existingModified, fmt.Sprint(card.Comfort, " ", tags), fmt.Sprint(existing.Comfort, " ", existingTags.String))
+	if !content && !state {
+		return false, nil
+	}
+	if ok, err := untrash(tx, card.UUID, deleted, edited); !ok || err != nil {
+		return false, err
+	}
+	if content {
+		if err = reviseCard(tx, existing.ID, card.Front, card.Back, RevisionSync, now); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "front" = @front, "back" = @back, "content_modified" = @contentModified, "changed" = @changed, "deleted" = NULL
+			WHERE "id" = @id`, card.Front, card.Back, contentModified, now, existing.ID)
+		if err != nil {
+			return false, err
+		}
+	}
+	if state {
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "deck" = @deck, "tags" = @tags, "last_practiced" = @lastPracticed, "comfort" = @comfort, "modified" = @modified, "changed" = @changed, "deleted" = NULL
+			WHERE "id" = @id`, deck, tags, lastPracticed, card.Comfort, modified, now, existing.ID)
+		if err != nil {
+			return false, err
+		}
+		if err = applyCardState(tx, card); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// applyCardState sets whether a synced card is suspended, buried or learning,
+// apart from the rest of the card to stay within the limit on SQL variables.
+func applyCardState(tx *sql.Tx, card *SyncCard) error {
+	step, due, relearning := nullLearning(card.Learning)
+	_, err := tx.Exec(`UPDATE "cards"
+		SET "suspended" = @suspended, "buried_until" = @buriedUntil, "learning_step" = @step, "learning_due" = @due, "relearning" = @relearning
+		WHERE "uuid" = @uuid`, card.Suspended, nullUnix(card.BuriedUntil), step, due, relearning, card.UUID)
+	return err
+}
+
+// applyTombstone moves a deck or card to the trash unless it was edited after
+// it was deleted by the peer.
+func applyTombstone(tx *sql.Tx, tombstone *SyncTombstone, now int64) (bool, error) {
+	deleted := tombstone.Deleted.UnixMilli()
+
+	var existing int64
+	err := tx.QueryRow(`SELECT "deleted"
+		FROM "tombstones"
+		WHERE "uuid" = @uuid`, tombstone.UUID).Scan(&existing)
+	if err == nil && existing >= deleted {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	table := `"decks"`
+	if tombstone.Kind == "card" {
+		table = `"cards"`
+	}
+	var modified int64
+	column := `"modified"`
+	if tombstone.Kind == "card" {
+		column = `MAX("modified", "content_modified")`
+	}
+	err = tx.QueryRow(`SELECT `+column+` FROM `+table+` WHERE "uuid" = @uuid`, tombstone.UUID).Scan(&modified)
+	if err == nil && modified > deleted {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	_, err = tx.Exec(`UPDATE `+table+`
+		SET "deleted" = @deleted, "changed" = @changed
+		WHERE "uuid" = @uuid AND "deleted" IS NULL`, deleted, now, tombstone.UUID)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO "tombstones" ("uuid", "kind", "deleted", "changed")
+		VALUES (@uuid, @kind, @deleted, @changed)`, tombstone.UUID, tombstone.Kind, deleted, now)
+	return err == nil, err
+}
+
+// untrash reports whether a deck or card, edited elsewhere at modified, is to be
+// taken out of the trash here. It is if it was edited after it was deleted, or
+// is not in the trash. Its tombstone is removed so that the edit is synced.
+func untrash(tx *sql.Tx, uuid string, deleted sql.NullInt64, modified int64) (bool, error) {
+	if !deleted.Valid {
+		return true, nil
+	}
+	if deleted.Int64 >= modified {
+		return false, nil
+	}
+	_, err := tx.Exec(`DELETE FROM "tombstones" WHERE "uuid" = @uuid`, uuid)
+	return err == nil, err
+}
+
+// addTombstone records the deletion of a deck or card, by kind and ID, for
+// sync.
+func addTombstone(tx *sql.Tx, kind string, id int64) error {
+	table := `"decks"`
+	if kind == "card" {
+		table = `"cards"`
+	}
+	_, err := tx.Exec(`INSERT OR REPLACE INTO "tombstones" ("uuid", "kind", "deleted", "changed")
+		SELECT "uuid", @kind, @now, @now
+		FROM `+table+`
+		WHERE "id" = @id AND "uuid" IS NOT NULL`, kind, time.Now().UnixMilli(), id)
+	return err
+}
@@ -0,0 +1,317 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func newTestTrana(t *testing.T) *Trana {
+	t.Helper()
+	tr, err := New(":memory:", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+// syncTest syncs a with b as its peer, sending the request and response
+// through JSON as over HTTP.
+func syncTest(t *testing.T, a, b *Trana) *SyncResult {
+	t.Helper()
+	ctx := context.Background()
+	result, err := a.SyncPeer(ctx, "b", func(req *SyncRequest) (*SyncResponse, error) {
+		var sent SyncRequest
+		jsonRoundTrip(t, req, &sent)
+		resp, err := b.SyncServe(ctx, &sent)
+		if err != nil {
+			return nil, err
+		}
+		var received SyncResponse
+		jsonRoundTrip(t, resp, &received)
+		return &received, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func jsonRoundTrip(t *testing.T, v, out any) {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(b, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tick waits for the clock to move on, so that edits are ordered by their
+// modified times.
+func tick() {
+	time.Sleep(2 * time.Millisecond)
+}
+
+// cardsByFront returns the cards of the only deck, by front.
+func cardsByFront(t *testing.T, tr *Trana) map[string]Card {
+	t.Helper()
+	ctx := context.Background()
+	decks, err := tr.ListDecks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decks) != 1 {
+		t.Fatalf("got %d decks; want 1", len(decks))
+	}
+	cards, err := tr.ListCards(ctx, decks[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byFront := make(map[string]Card)
+	for _, card := range cards {
+		byFront[card.Front] = card
+	}
+	return byFront
+}
+
+func countReviews(t *testing.T, tr *Trana) int {
+	t.Helper()
+	var n int
+	err := tr.db.Tx(context.Background(), func(tx *sql.Tx) error {
+		return tx.QueryRow(`SELECT COUNT(*) FROM "reviews"`).Scan(&n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	a := newTestTrana(t)
+	b := newTestTrana(t)
+
+	deck, err := a.CreateDeck(ctx, "Swedish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, front := range []string{"hund", "katt", "häst", "ko"} {
+		if _, err = a.CreateCard(ctx, deck, front, front+"?"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		result := syncTest(t, a, b)
+		if result.Sent != 5 || result.Received != 0 {
+			t.Fatalf("sent %d, received %d; want 5, 0", result.Sent, result.Received)
+		}
+		cards := cardsByFront(t, b)
+		if len(cards) != 4 || cards["hund"].Back != "hund?" {
+			t.Fatalf("b has cards %+v; want the 4 cards of a", cards)
+		}
+	})
+
+	t.Run("latest edit wins", func(t *testing.T) {
+		// a edits the back, b edits it later, then a reviews the card: b's
+		// back and a's review are both kept
+		card := cardsByFront(t, a)["hund"]
+		card.Back = "dog"
+		if err = a.UpdateCard(ctx, &card, RevisionUI); err != nil {
+			t.Fatal(err)
+		}
+		tick()
+		card = cardsByFront(t, b)["hund"]
+		card.Back = "hound"
+		if err = b.UpdateCard(ctx, &card, RevisionUI); err != nil {
+			t.Fatal(err)
+		}
+		tick()
+		if _, err = a.ReviewCard(ctx, cardsByFront(t, a)["hund"].ID, ComfortReviewMax, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		syncTest(t, a, b)
+		for name, tr := range map[string]*Trana{"a": a, "b": b} {
+			got := cardsByFront(t, tr)["hund"]
+			if got.Back != "hound" {
+				t.Errorf("%s: back %q; want %q", name, got.Back, "hound")
+			}
+			if got.LastPracticed == nil {
+				t.Errorf("%s: review of a was lost", name)
+			}
+		}
+	})
+
+	t.Run("tombstones", func(t *testing.T) {
+		// katt is edited before b deletes it, häst after b deletes it
+		card := cardsByFront(t, a)["katt"]
+		card.Back = "cat"
+		if err = a.UpdateCard(ctx, &card, RevisionUI); err != nil {
+			t.Fatal(err)
+		}
+		tick()
+		for _, front := range []string{"katt", "häst"} {
+			if err = b.DeleteCard(ctx, cardsByFront(t, b)[front].ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tick()
+		card = cardsByFront(t, a)["häst"]
+		card.Back = "horse"
+		if err = a.UpdateCard(ctx, &card, RevisionUI); err != nil {
+			t.Fatal(err)
+		}
+
+		syncTest(t, a, b)
+		for name, tr := range map[string]*Trana{"a": a, "b": b} {
+			cards := cardsByFront(t, tr)
+			if _, ok := cards["katt"]; ok {
+				t.Errorf("%s: katt was edited before it was deleted, but was kept", name)
+			}
+			if got, ok := cards["häst"]; !ok || got.Back != "horse" {
+				t.Errorf("%s: häst %+v; want kept with its newer edit", name, got)
+			}
+		}
+	})
+
+	t.Run("reviews", func(t *testing.T) {
+		if _, err = a.ReviewCard(ctx, cardsByFront(t, a)["ko"].ID, ComfortReviewMin, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = b.ReviewCard(ctx, cardsByFront(t, b)["ko"].ID, ComfortReviewMax, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		syncTest(t, a, b)
+		// The review of hund and both reviews of ko
+		if got, want := countReviews(t, a), 3; got != want {
+			t.Errorf("a has %d reviews; want %d", got, want)
+		}
+		if got, want := countReviews(t, b), 3; got != want {
+			t.Errorf("b has %d reviews; want %d", got, want)
+		}
+	})
+
+	t.Run("nothing to apply", func(t *testing.T) {
+		if result := syncTest(t, a, b); result.Applied != 0 {
+			t.Fatalf("applied %d; want 0", result.Applied)
+		}
+	})
+}
+
+// syncEdit is an edit of the only card of a peer, by the peer.
+type syncEdit struct {
+	peer string
+	edit func(t *testing.T, tr *Trana, card Card)
+}
+
+func editCard(front, back string) func(*testing.T, *Trana, Card) {
+	return func(t *testing.T, tr *Trana, card Card) {
+		card.Front, card.Back = front, back
+		if err := tr.UpdateCard(context.Background(), &card, RevisionUI); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func deleteCard(t *testing.T, tr *Trana, card Card) {
+	if err := tr.DeleteCard(context.Background(), card.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func reviewCard(t *testing.T, tr *Trana, card Card) {
+	if _, err := tr.ReviewCard(context.Background(), card.ID, ComfortReviewMax, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncConflicts(t *testing.T) {
+	testcases := map[string]struct {
+		// Edits in order, each later than the one before
+		edits []syncEdit
+
+		// The card on both peers after syncing, nil if deleted
+		want      *Card
+		practiced bool
+	}{
+		"later edit of b": {
+			edits: []syncEdit{{"a", editCard("hund", "dog")}, {"b", editCard("hund", "hound")}},
+			want:  &Card{Front: "hund", Back: "hound"},
+		},
+		"later edit of a": {
+			edits: []syncEdit{{"b", editCard("hund", "hound")}, {"a", editCard("hund", "dog")}},
+			want:  &Card{Front: "hund", Back: "dog"},
+		},
+		"front edited": {
+			// Cards are matched by UUID, not by front
+			edits: []syncEdit{{"a", editCard("en hund", "dog")}},
+			want:  &Card{Front: "en hund", Back: "dog"},
+		},
+		"review after an edit": {
+			// A review is not an edit of the content
+			edits:     []syncEdit{{"a", editCard("hund", "dog")}, {"b", reviewCard}},
+			want:      &Card{Front: "hund", Back: "dog"},
+			practiced: true,
+		},
+		"edit before delete": {
+			edits: []syncEdit{{"a", editCard("hund", "dog")}, {"b", deleteCard}},
+		},
+		"delete before edit": {
+			edits: []syncEdit{{"b", deleteCard}, {"a", editCard("hund", "dog")}},
+			want:  &Card{Front: "hund", Back: "dog"},
+		},
+		"review after delete": {
+			// A change of the practice state is newer than the deletion too
+			edits:     []syncEdit{{"a", deleteCard}, {"b", reviewCard}},
+			want:      &Card{Front: "hund", Back: "hund?"},
+			practiced: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			peers := map[string]*Trana{"a": newTestTrana(t), "b": newTestTrana(t)}
+			deck, err := peers["a"].CreateDeck(ctx, "Swedish")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = peers["a"].CreateCard(ctx, deck, "hund", "hund?"); err != nil {
+				t.Fatal(err)
+			}
+			syncTest(t, peers["a"], peers["b"])
+
+			for _, e := range tc.edits {
+				tick()
+				for _, card := range cardsByFront(t, peers[e.peer]) {
+					e.edit(t, peers[e.peer], card)
+				}
+			}
+			syncTest(t, peers["a"], peers["b"])
+
+			for name, tr := range peers {
+				cards := cardsByFront(t, tr)
+				if tc.want == nil {
+					if len(cards) != 0 {
+						t.Errorf("%s: cards %+v; want none", name, cards)
+					}
+					continue
+				}
+				got, ok := cards[tc.want.Front]
+				if len(cards) != 1 || !ok || got.Back != tc.want.Back {
+					t.Errorf("%s: cards %+v; want %s, %s", name, cards, tc.want.Front, tc.want.Back)
+				}
+				if practiced := got.LastPracticed != nil; practiced != tc.practiced {
+					t.Errorf("%s: practiced %v; want %v", name, practiced, tc.practiced)
+				}
+			}
+		})
+	}
+}
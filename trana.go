@@ -24,53 +24,274 @@ const (
 
 var ErrBadComfort = fmt.Errorf("trana: comfort must be from %d to %d", ComfortReviewMax, ComfortReviewMax)
 
+// Scheduler selects the order in which NextCard returns cards.
+type Scheduler string
+
+const (
+	// Least comfortable cards first
+	SchedulerComfort Scheduler = "comfort"
+
+	// Cards practiced longest ago first, unpracticed cards before all others
+	SchedulerLeastRecent Scheduler = "least_recent"
+)
+
+var ErrBadScheduler = errors.New("trana: unknown scheduler")
+
+func (s Scheduler) Valid() bool {
+	switch s {
+	case SchedulerComfort, SchedulerLeastRecent:
+		return true
+	default:
+		return false
+	}
+}
+
+type Options struct {
+	// Defaults to SchedulerComfort
+	Scheduler Scheduler
+
+	// Directory of imported media files, media is not imported if empty
+	MediaDir string
+
+	// Time zone of day boundaries in statistics, defaults to time.Local
+	Location *time.Location
+
+	// How long deleted decks and cards are kept in the trash, defaults to
+	// DefaultTrashRetention
+	TrashRetention time.Duration
+
+	// Number of other cards NextCard shows before repeating a reviewed
+	// card, and the time it waits before repeating one. Either is
+	// disabled if not positive. A card is still repeated when no other
+	// card of the deck is left.
+	RepeatGap   int
+	RepeatDelay time.Duration
+
+	// Bury the siblings of a reviewed card until tomorrow, the cards of
+	// its deck with its front and back swapped
+	BurySiblings bool
+}
+
 type Trana struct {
-	db db.DB
+	db        db.DB
+	scheduler Scheduler
+	mediaDir  string
+	location  *time.Location
+
+	trashRetention time.Duration
+
+	repeatGap    int
+	repeatDelay  time.Duration
+	burySiblings bool
 }
 
 type Deck struct {
 	ID   int64
+	UUID string
 	Name string
+
+	// Steps of new and lapsed cards, set with SetLearningSteps
+	LearningSteps   []time.Duration
+	RelearningSteps []time.Duration
+
+	// ID of the DeckSettings used by the deck, set with UseDeckSettings
+	Settings int64
 }
 
 type Card struct {
 	ID            int64
+	UUID          string
 	Deck          int64
 	Front         string
 	Back          string
+	Tags          []string
 	LastPracticed *time.Time
 	Comfort       float64
+
+	// Left out of NextCard until unsuspended
+	Suspended bool
+
+	// Left out of NextCard until then, nil if not buried
+	BuriedUntil *time.Time
+
+	// Step of the card in learning, nil if it is not learning
+	Learning *Learning
+}
+
+// Buried reports whether the card is buried now.
+func (c *Card) Buried() bool {
+	return c.BuriedUntil != nil && time.Now().Before(*c.BuriedUntil)
+}
+
+// Review is a practice of a card with the comfort chosen, from
+// ComfortReviewMin to ComfortReviewMax.
+type Review struct {
+	ID      int64
+	Card    int64
+	Time    time.Time
+	Comfort float64
+
+	// Whether the answer matched the card, nil if unknown
+	Correct *bool
+
+	// Time taken to answer, 0 if unknown
+	Duration time.Duration
+}
+
+type ReviewOptions struct {
+	// Whether the answer matched the card, nil if unknown
+	Correct *bool
+
+	// Time taken to answer, 0 if unknown
+	Duration time.Duration
+}
+
+// ReviewResult is what ReviewCard wrote, to undo it with UndoReview.
+type ReviewResult struct {
+	// ID of the review
+	ID int64
+
+	// Siblings of the card buried by the review
+	Buried []int64
+}
+
+const (
+	deckColumns = `"id", "uuid", "name", "learning_steps", "relearning_steps", COALESCE("settings", 1)`
+	cardColumns = `"id", "uuid", "deck", "front", "back", "tags", "last_practiced", "comfort", "suspended", "buried_until", "learning_step", "learning_due", "relearning"`
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanExtra scans columns following those of scanDeck or scanCard into extra.
+type scanExtra struct {
+	scanner
+	extra []any
+}
+
+func (s scanExtra) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
+
+// scanDeck scans the deckColumns of a row.
+func scanDeck(s scanner, deck *Deck) error {
+	var uuid, learning, relearning sql.NullString
+	if err := s.Scan(&deck.ID, &uuid, &deck.Name, &learning, &relearning, &deck.Settings); err != nil {
+		return err
+	}
+	deck.UUID = uuid.String
+	deck.LearningSteps = scanSteps(learning, DefaultLearningSteps)
+	deck.RelearningSteps = scanSteps(relearning, DefaultRelearningSteps)
+	return nil
+}
+
+// scanCard scans the cardColumns of a row.
+func scanCard(s scanner, card *Card) error {
+	var uuid, tags sql.NullString
+	var lastPracticed, buriedUntil, step, due sql.NullInt64
+	var relearning bool
+	if err := s.Scan(&card.ID, &uuid, &card.Deck, &card.Front, &card.Back, &tags, &lastPracticed, &card.Comfort, &card.Suspended, &buriedUntil, &step, &due, &relearning); err != nil {
+		return err
+	}
+	card.Learning = scanLearning(step, due, relearning)
+	card.UUID = uuid.String
+	card.Tags = strings.Fields(tags.String)
+	card.LastPracticed = unixTime(lastPracticed)
+	card.BuriedUntil = unixTime(buriedUntil)
+	return nil
+}
+
+// unixTime is the time of Unix seconds, nil if NULL.
+func unixTime(unix sql.NullInt64) *time.Time {
+	if !unix.Valid {
+		return nil
+	}
+	t := time.Unix(unix.Int64, 0)
+	return &t
 }
 
-func New(path string) (*Trana, error) {
+// nullUnix is the Unix seconds of t, NULL if nil.
+func nullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+func New(path string, opts *Options) (*Trana, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	scheduler := opts.Scheduler
+	if scheduler == "" {
+		scheduler = SchedulerComfort
+	}
+	if !scheduler.Valid() {
+		return nil, ErrBadScheduler
+	}
+	location := opts.Location
+	if location == nil {
+		location = time.Local
+	}
+	trashRetention := opts.TrashRetention
+	if trashRetention <= 0 {
+		trashRetention = DefaultTrashRetention
+	}
+
 	db, err := db.NewSQLite(path)
 	if err != nil {
 		return nil, err
 	}
-	return &Trana{db}, nil
+	if err = db.Tx(context.Background(), fillUUIDs); err != nil {
+		db.Close()
+		return nil, err
+	}
+	t := &Trana{
+		db:             db,
+		scheduler:      scheduler,
+		mediaDir:       opts.MediaDir,
+		location:       location,
+		trashRetention: trashRetention,
+		repeatGap:      opts.RepeatGap,
+		repeatDelay:    opts.RepeatDelay,
+		burySiblings:   opts.BurySiblings,
+	}
+	if err = t.PurgeTrash(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return t, nil
 }
 
 func (t *Trana) Close() error {
 	return t.db.Close()
 }
 
-func (t *Trana) CreateDeck(ctx context.Context, name string) error {
+func (t *Trana) CreateDeck(ctx context.Context, name string) (int64, error) {
 	name = cleanString(name)
+	now := time.Now().UnixMilli()
 
-	return t.db.Tx(ctx, func(tx *sql.Tx) error {
-		_, err := tx.Exec(`INSERT INTO "decks" ("name")
-			VALUES (@name)`, name)
+	var id int64
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO "decks" ("uuid", "name", "modified", "changed")
+			VALUES (@uuid, @name, @now, @now)`, newUUID(), name, now)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
 		return err
 	})
+	return id, err
 }
 
 func (t *Trana) GetDeck(ctx context.Context, id int64) (*Deck, error) {
 	var deck Deck
 	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
-		return tx.QueryRow(`SELECT "id", "name"
+		return scanDeck(tx.QueryRow(`SELECT `+deckColumns+`
 			FROM "decks"
 			WHERE "id" = @id
-			LIMIT 1`, id).Scan(&deck.ID, &deck.Name)
+			LIMIT 1`, id), &deck)
 	})
 	if err != nil {
 		return nil, err
@@ -80,28 +301,44 @@ func (t *Trana) GetDeck(ctx context.Context, id int64) (*Deck, error) {
 
 func (t *Trana) UpdateDeck(ctx context.Context, deck *Deck) error {
 	name := cleanString(deck.Name)
+	now := time.Now().UnixMilli()
 
 	return t.db.Tx(ctx, func(tx *sql.Tx) error {
 		_, err := tx.Exec(`UPDATE "decks"
-			SET "name" = @name
-			WHERE "id" = @id`, name, deck.ID)
+			SET "name" = @name, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`, name, now, deck.ID)
 		return err
 	})
 }
 
+// DeleteDeck moves a deck and its cards to the trash, from which they are
+// purged after Options.TrashRetention. It returns sql.ErrNoRows if the deck does
+// not exist or is already in the trash.
 func (t *Trana) DeleteDeck(ctx context.Context, id int64) error {
 	return t.db.Tx(ctx, func(tx *sql.Tx) error {
-		_, err := tx.Exec(`DELETE FROM "decks"
-			WHERE "id" = @id`, id)
-		return err
+		result, err := tx.Exec(`UPDATE "decks"
+			SET "deleted" = @now, "changed" = @now
+			WHERE "id" = @id AND "deleted" IS NULL`, time.Now().UnixMilli(), id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return addTombstone(tx, "deck", id)
 	})
 }
 
 func (t *Trana) ListDecks(ctx context.Context) ([]Deck, error) {
 	var decks []Deck
 	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
-		rows, err := tx.Query(`SELECT "id", "name"
+		rows, err := tx.Query(`SELECT ` + deckColumns + `
 			FROM "decks"
+			WHERE "deleted" IS NULL
 			ORDER BY "id" ASC`)
 		if err != nil {
 			return err
@@ -109,7 +346,7 @@ func (t *Trana) ListDecks(ctx context.Context) ([]Deck, error) {
 		defer rows.Close()
 		for rows.Next() {
 			var deck Deck
-			if err = rows.Scan(&deck.ID, &deck.Name); err != nil {
+			if err = scanDeck(rows, &deck); err != nil {
 				return err
 			}
 			decks = append(decks, deck)
@@ -122,61 +359,209 @@ func (t *Trana) ListDecks(ctx context.Context) ([]Deck, error) {
 	return decks, nil
 }
 
-func (t *Trana) CreateCard(ctx context.Context, deck int64, front, back string) error {
+func (t *Trana) CreateCard(ctx context.Context, deck int64, front, back string) (int64, error) {
 	front = cleanString(front)
 	back = cleanString(back)
+	now := time.Now().UnixMilli()
 
-	return t.db.Tx(ctx, func(tx *sql.Tx) error {
-		_, err := tx.Exec(`INSERT INTO "cards" ("deck", "front", "back")
-			VALUES (@deck, @front, @back)`, deck, front, back)
+	var id int64
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO "cards" ("uuid", "deck", "front", "back", "content_modified", "modified", "changed")
+			VALUES (@uuid, @deck, @front, @back, @now, @now, @now)`, newUUID(), deck, front, back, now)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
 		return err
 	})
+	return id, err
 }
 
 func (t *Trana) GetCard(ctx context.Context, id int64) (*Card, error) {
 	var card Card
-	var lastPracticed sql.NullInt64
-
 	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
-		return tx.QueryRow(`SELECT "id", "deck", "front", "back", "last_practiced", "comfort"
+		return scanCard(tx.QueryRow(`SELECT `+cardColumns+`
 			FROM "cards"
 			WHERE "id" = @id
-			LIMIT 1`, id).Scan(&card.ID, &card.Deck, &card.Front, &card.Back, &lastPracticed, &card.Comfort)
+			LIMIT 1`, id), &card)
 	})
 	if err != nil {
 		return nil, err
 	}
-
-	if lastPracticed.Valid {
-		t := time.Unix(lastPracticed.Int64, 0)
-		card.LastPracticed = &t
-	}
 	return &card, nil
 }
 
+// practiceCards is the condition of cards which NextCard may return at @now in
+// Unix seconds. It is grouped to keep the expression tree of queries adding
+// conditions shallow.
+const practiceCards = `("deleted" IS NULL AND NOT "suspended" AND COALESCE("buried_until", 0) <= @now)`
+
+// NextCard returns the card of a deck to practice next, in the order of the
+// scheduler and settings of the deck. Cards in learning whose step is due come
+// first, earliest first. Other cards reviewed within Options.RepeatGap or
+// Options.RepeatDelay are skipped, and cards in learning whose step is not yet
+// due are only returned when no card is left but those, before the one
+// practiced longest ago. It returns sql.ErrNoRows when no card is left, also
+// when the daily limits of the deck are reached.
 func (t *Trana) NextCard(ctx context.Context, deck int64) (*Card, error) {
-	var card Card
-	var lastPracticed sql.NullInt64
+	var card *Card
+	now := time.Now()
 
 	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
-		return tx.QueryRow(`SELECT "id", "deck", "front", "back", "last_practiced", "comfort"
+		settings, err := getDeckSettings(tx, deck)
+		if err != nil {
+			return err
+		}
+		scheduler := settings.Scheduler
+		if scheduler == "" {
+			scheduler = t.scheduler
+		}
+		tie := `RANDOM()`
+		if settings.Order == OrderCreated {
+			tie = `"id" ASC`
+		}
+		order := `"comfort" ASC, ` + tie
+		if scheduler == SchedulerLeastRecent {
+			order = `"last_practiced" ASC NULLS FIRST, ` + tie
+		}
+
+		learning := func(due string) error {
+			var c Card
+			err := scanCard(tx.QueryRow(`SELECT `+cardColumns+`
+				FROM "cards"
+				WHERE "deck" = @deck AND `+practiceCards+` AND `+due+`
+				ORDER BY "learning_due" ASC
+				LIMIT 1`, deck, now.Unix()), &c)
+			if err == nil {
+				card = &c
+			}
+			return err
+		}
+		if err := learning(`"learning_due" <= @now`); !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		newLeft, reviewsLeft, err := t.limitsLeft(tx, deck, settings, now)
+		if err != nil {
+			return err
+		}
+		if reviewsLeft == 0 {
+			return sql.ErrNoRows
+		}
+		filter := `"learning_due" IS NULL`
+		if newLeft == 0 {
+			filter = `"learning_due" IS NULL AND "comfort" != -1`
+		}
+
+		recent, err := t.recentCards(tx, deck, now)
+		if err != nil {
+			return err
+		}
+
+		// Enough cards in order that one is not recent, if there is any
+		rows, err := tx.Query(`SELECT `+cardColumns+`
 			FROM "cards"
-			WHERE "deck" = @deck
-			ORDER BY "comfort" ASC, RANDOM()
-			LIMIT 1`, deck).Scan(&card.ID, &card.Deck, &card.Front, &card.Back, &lastPracticed, &card.Comfort)
+			WHERE "deck" = @deck AND `+practiceCards+` AND `+filter+`
+			ORDER BY `+order+`
+			LIMIT @limit`, deck, now.Unix(), len(recent)+1)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var fallback *Card
+		for rows.Next() {
+			var c Card
+			if err = scanCard(rows, &c); err != nil {
+				return err
+			}
+			if _, ok := recent[c.ID]; !ok {
+				card = &c
+				return nil
+			}
+			// Reviews within the same second are told apart by their order
+			if fallback == nil || c.LastPracticed.Before(*fallback.LastPracticed) ||
+				c.LastPracticed.Equal(*fallback.LastPracticed) && recent[c.ID] > recent[fallback.ID] {
+				fallback = &c
+			}
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if err = learning(`"learning_due" IS NOT NULL`); !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if fallback == nil {
+			return sql.ErrNoRows
+		}
+		card = fallback
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	return card, nil
+}
 
-	if lastPracticed.Valid {
-		t := time.Unix(lastPracticed.Int64, 0)
-		card.LastPracticed = &t
+// recentCards returns the cards of a deck which NextCard does not repeat yet:
+// those of the last Options.RepeatGap reviews and those practiced within
+// Options.RepeatDelay. All of them have been practiced. Each card maps to the
+// number of reviews since its last one, or to Options.RepeatGap if there are
+// more.
+func (t *Trana) recentCards(tx *sql.Tx, deck int64, now time.Time) (map[int64]int, error) {
+	recent := make(map[int64]int)
+	ids := func(query string, args ...any) ([]int64, error) {
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err = rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, rows.Err()
 	}
-	return &card, nil
+
+	if t.repeatGap > 0 {
+		reviewed, err := ids(`SELECT "card"
+			FROM "reviews"
+			JOIN "cards" ON "cards"."id" = "reviews"."card"
+			WHERE "deck" = @deck AND "last_practiced" IS NOT NULL
+			ORDER BY "time" DESC, "reviews"."id" DESC
+			LIMIT @gap`, deck, t.repeatGap)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range reviewed {
+			if _, ok := recent[id]; !ok {
+				recent[id] = i
+			}
+		}
+	}
+	if t.repeatDelay > 0 {
+		practiced, err := ids(`SELECT "id"
+			FROM "cards"
+			WHERE "deck" = @deck AND "last_practiced" > @since`, deck, now.Add(-t.repeatDelay).Unix())
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range practiced {
+			if _, ok := recent[id]; !ok {
+				recent[id] = t.repeatGap
+			}
+		}
+	}
+	return recent, nil
 }
 
-func (t *Trana) UpdateCard(ctx context.Context, card *Card) error {
+// UpdateCard writes the card, recording a change of its front or back as a
+// revision from source.
+func (t *Trana) UpdateCard(ctx context.Context, card *Card, source RevisionSource) error {
 	if card == nil {
 		return errors.New("card is nil")
 	}
@@ -186,77 +571,206 @@ func (t *Trana) UpdateCard(ctx context.Context, card *Card) error {
 
 	front := cleanString(card.Front)
 	back := cleanString(card.Back)
+	tags := joinTags(card.Tags)
 	var lastPracticed sql.NullInt64
 	if card.LastPracticed != nil {
 		lastPracticed.Valid = true
 		lastPracticed.Int64 = card.LastPracticed.Unix()
 	}
+	now := time.Now().UnixMilli()
 
 	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		if err := reviseCard(tx, card.ID, front, back, source, now); err != nil {
+			return err
+		}
+		// The content and the practice state are synced apart, so each is
+		// only marked modified if it changed
 		_, err := tx.Exec(`UPDATE "cards"
-			SET "front" = @front, "back" = @back, "last_practiced" = @lastPracticed, "comfort" = @comfort
-			WHERE "id" = @id`, front, back, lastPracticed, card.Comfort, card.ID)
+			SET "content_modified" = @now
+			WHERE "id" = @id AND ("front" != @front OR "back" != @back)`, now, card.ID, front, back)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "modified" = @now
+			WHERE "id" = @id AND (COALESCE("tags", '') != @tags OR "last_practiced" IS NOT @lastPracticed OR "comfort" != @comfort)`,
+			now, card.ID, tags, lastPracticed, card.Comfort)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "front" = @front, "back" = @back, "tags" = @tags, "last_practiced" = @lastPracticed, "comfort" = @comfort, "changed" = @now
+			WHERE "id" = @id`, front, back, tags, lastPracticed, card.Comfort, now, card.ID)
 		return err
 	})
 }
 
-func (t *Trana) ReviewCard(ctx context.Context, id int64, comfort float64) error {
-	if comfort < ComfortReviewMin || comfort > ComfortReviewMax {
-		return ErrBadComfort
+// UpdateCardContent writes the front, back and tags of the card, leaving its
+// practice state as it is, and records a change of its front or back as a
+// revision from source.
+func (t *Trana) UpdateCardContent(ctx context.Context, card *Card, source RevisionSource) error {
+	if card == nil {
+		return errors.New("card is nil")
 	}
-	comfort = comfortNorm(comfort)
+
+	front := cleanString(card.Front)
+	back := cleanString(card.Back)
+	tags := joinTags(card.Tags)
+	now := time.Now().UnixMilli()
 
 	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		if err := reviseCard(tx, card.ID, front, back, source, now); err != nil {
+			return err
+		}
 		_, err := tx.Exec(`UPDATE "cards"
-			SET "comfort" = @comfort, "last_practiced" = @lastPracticed
-			WHERE "id" = @id`, comfort, time.Now().Unix(), id)
+			SET "content_modified" = @now
+			WHERE "id" = @id AND ("front" != @front OR "back" != @back)`, now, card.ID, front, back)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "modified" = @now
+			WHERE "id" = @id AND COALESCE("tags", '') != @tags`, now, card.ID, tags)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "front" = @front, "back" = @back, "tags" = @tags, "changed" = @now
+			WHERE "id" = @id`, front, back, tags, now, card.ID)
 		return err
 	})
 }
 
-func (t *Trana) DeleteCard(ctx context.Context, id int64) error {
-	return t.db.Tx(ctx, func(tx *sql.Tx) error {
-		_, err := tx.Exec(`DELETE FROM "cards"
-			WHERE "id" = @id`, id)
-		return err
-	})
-}
+// ReviewCard records a practice of the card, setting its comfort, and returns
+// what it wrote. New cards and cards reviewed with ComfortReviewMin go
+// through the learning or relearning steps of their deck. With
+// Options.BurySiblings the siblings of the card are buried.
+func (t *Trana) ReviewCard(ctx context.Context, id int64, comfort float64, opts *ReviewOptions) (*ReviewResult, error) {
+	if comfort < ComfortReviewMin || comfort > ComfortReviewMax {
+		return nil, ErrBadComfort
+	}
+	if opts == nil {
+		opts = &ReviewOptions{}
+	}
+	now := time.Now()
 
-func (t *Trana) ListCards(ctx context.Context, deck int64) ([]Card, error) {
-	var cards []Card
+	var review ReviewResult
 	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
-		rows, err := tx.Query(`SELECT "id", "deck", "front", "back", "last_practiced", "comfort"
+		var before float64
+		var step, due sql.NullInt64
+		var relearning bool
+		var learningSteps, relearningSteps sql.NullString
+		err := tx.QueryRow(`SELECT "cards"."comfort", "learning_step", "learning_due", "relearning", "learning_steps", "relearning_steps"
 			FROM "cards"
-			WHERE "deck" = @deck
-			ORDER BY "id" ASC`, deck)
+			JOIN "decks" ON "decks"."id" = "cards"."deck"
+			WHERE "cards"."id" = @id`, id).Scan(&before, &step, &due, &relearning, &learningSteps, &relearningSteps)
+		if err != nil {
+			return err
+		}
+		learning := nextLearning(scanLearning(step, due, relearning), before, comfort,
+			scanSteps(learningSteps, DefaultLearningSteps), scanSteps(relearningSteps, DefaultRelearningSteps), now)
+		step, due, relearning = nullLearning(learning)
+
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "comfort" = @comfort, "last_practiced" = @lastPracticed, "learning_step" = @step, "learning_due" = @due, "relearning" = @relearning, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`, comfortNorm(comfort), now.Unix(), step, due, relearning, now.UnixMilli(), id)
+		if err != nil {
+			return err
+		}
+		var correct sql.NullBool
+		if opts.Correct != nil {
+			correct.Valid = true
+			correct.Bool = *opts.Correct
+		}
+		var duration sql.NullInt64
+		if opts.Duration > 0 {
+			duration.Valid = true
+			duration.Int64 = opts.Duration.Milliseconds()
+		}
+		result, err := tx.Exec(`INSERT INTO "reviews" ("card", "time", "comfort", "correct", "duration", "changed")
+			VALUES (@card, @time, @comfort, @correct, @duration, @changed)`, id, now.Unix(), comfort, correct, duration, now.UnixMilli())
+		if err != nil {
+			return err
+		}
+		if review.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		if !t.burySiblings {
+			return nil
+		}
+
+		// Siblings already buried are left to their own unburying
+		rows, err := tx.Query(`SELECT "id"
+			FROM "cards"
+			WHERE ("deck", "front", "back") = (SELECT "deck", "back", "front" FROM "cards" WHERE "id" = @id)
+				AND ("id" != @id AND "deleted" IS NULL) AND COALESCE("buried_until", 0) <= @now`, id, now.Unix())
 		if err != nil {
 			return err
 		}
 		defer rows.Close()
 		for rows.Next() {
-			var card Card
-			var lastPracticed sql.NullInt64
-			if err = rows.Scan(&card.ID, &card.Deck, &card.Front, &card.Back, &lastPracticed, &card.Comfort); err != nil {
+			var sibling int64
+			if err = rows.Scan(&sibling); err != nil {
 				return err
 			}
-			if lastPracticed.Valid {
-				t := time.Unix(lastPracticed.Int64, 0)
-				card.LastPracticed = &t
+			review.Buried = append(review.Buried, sibling)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		for _, sibling := range review.Buried {
+			_, err = tx.Exec(`UPDATE "cards"
+				SET "buried_until" = @tomorrow, "modified" = @now, "changed" = @now
+				WHERE "id" = @id`, t.day(now).AddDate(0, 0, 1).Unix(), now.UnixMilli(), sibling)
+			if err != nil {
+				return err
 			}
-			cards = append(cards, card)
 		}
-		return rows.Err()
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return cards, nil
+	return &review, nil
 }
 
-func (t *Trana) Import(ctx context.Context, deck int64, cards []Card) error {
+// UndoReview removes a review of a card and puts back the comfort, time of
+// last practice and learning step the card had before it, and unburies the
+// siblings it buried. It returns sql.ErrNoRows if the review does not exist. A
+// review already synced to another collection stays there.
+func (t *Trana) UndoReview(ctx context.Context, review *ReviewResult, before *Card) error {
+	var lastPracticed sql.NullInt64
+	if before.LastPracticed != nil {
+		lastPracticed.Valid = true
+		lastPracticed.Int64 = before.LastPracticed.Unix()
+	}
+	step, due, relearning := nullLearning(before.Learning)
+	now := time.Now().UnixMilli()
+
 	return t.db.Tx(ctx, func(tx *sql.Tx) error {
-		for _, card := range cards {
-			if err := importCard(tx, deck, &card); err != nil {
+		result, err := tx.Exec(`DELETE FROM "reviews"
+			WHERE "id" = @id AND "card" = @card`, review.ID, before.ID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.Exec(`UPDATE "cards"
+			SET "comfort" = @comfort, "last_practiced" = @lastPracticed, "learning_step" = @step, "learning_due" = @due, "relearning" = @relearning, "modified" = @now, "changed" = @now
+			WHERE "id" = @id`, before.Comfort, lastPracticed, step, due, relearning, now, before.ID)
+		if err != nil {
+			return err
+		}
+		for _, sibling := range review.Buried {
+			_, err = tx.Exec(`UPDATE "cards"
+				SET "buried_until" = NULL, "modified" = @now, "changed" = @now
+				WHERE "id" = @id`, now, sibling)
+			if err != nil {
 				return err
 			}
 		}
@@ -264,39 +778,96 @@ func (t *Trana) Import(ctx context.Context, deck int64, cards []Card) error {
 	})
 }
 
-func importCard(tx *sql.Tx, deck int64, card *Card) error {
-	var lastPracticed sql.NullInt64
-	if card.LastPracticed != nil {
-		lastPracticed.Valid = true
-		lastPracticed.Int64 = card.LastPracticed.Unix()
-	}
+// SuspendCard leaves a card out of NextCard until it is unsuspended. Like the
+// other changes of state, it returns sql.ErrNoRows if the card does not exist.
+func (t *Trana) SuspendCard(ctx context.Context, id int64) error {
+	return t.setCardState(ctx, id, "suspended", true)
+}
 
-	card.Front = cleanString(card.Front)
-	card.Back = cleanString(card.Back)
+func (t *Trana) UnsuspendCard(ctx context.Context, id int64) error {
+	return t.setCardState(ctx, id, "suspended", false)
+}
 
-	var id int64
-	var back string
-	err := tx.QueryRow(`SELECT "id", "back"
-		FROM "cards"
-		WHERE "deck" = @deck AND "front" = @front
-		LIMIT 1`, deck, card.Front).Scan(&id, &back)
-	if err == nil {
-		if back == card.Back {
-			// Card is already in deck, override last_practiced and comfort
-			_, err = tx.Exec(`UPDATE "cards"
-				SET "last_practiced" = @lastPracticed, "comfort" = @comfort
-				WHERE "id" = @id`, lastPracticed, card.Comfort, id)
+// BuryCard leaves a card out of NextCard until tomorrow, in the time zone of
+// Options.Location.
+func (t *Trana) BuryCard(ctx context.Context, id int64) error {
+	tomorrow := t.day(time.Now()).AddDate(0, 0, 1)
+	return t.setCardState(ctx, id, "buried_until", tomorrow.Unix())
+}
+
+func (t *Trana) UnburyCard(ctx context.Context, id int64) error {
+	return t.setCardState(ctx, id, "buried_until", nil)
+}
+
+// setCardState sets a column of a card, as an edit of the card. It returns
+// sql.ErrNoRows if the card does not exist or is in the trash.
+func (t *Trana) setCardState(ctx context.Context, id int64, column string, value any) error {
+	now := time.Now().UnixMilli()
+
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE "cards"
+			SET "`+column+`" = @value, "modified" = @now, "changed" = @now
+			WHERE "id" = @id AND "deleted" IS NULL`, value, now, id)
+		if err != nil {
 			return err
 		}
-		return fmt.Errorf("imported card %d duplicates existing card %d (same front, different back)", card.ID, id)
-	}
-	if !errors.Is(err, sql.ErrNoRows) {
-		return err
-	}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// DeleteCard moves a card to the trash, from which it is purged after
+// Options.TrashRetention. It returns sql.ErrNoRows if the card does not exist or
+// is already in the trash.
+func (t *Trana) DeleteCard(ctx context.Context, id int64) error {
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE "cards"
+			SET "deleted" = @now, "changed" = @now
+			WHERE "id" = @id AND "deleted" IS NULL`, time.Now().UnixMilli(), id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return addTombstone(tx, "card", id)
+	})
+}
 
-	_, err = tx.Exec(`INSERT INTO "cards" ("deck", "front", "back", "last_practiced", "comfort")
-		VALUES (@deck, @front, @back, @lastPracticed, @comfort)`, deck, card.Front, card.Back, lastPracticed, card.Comfort)
-	return err
+func (t *Trana) ListCards(ctx context.Context, deck int64) ([]Card, error) {
+	var cards []Card
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT `+cardColumns+`
+			FROM "cards"
+			WHERE "deck" = @deck AND "deleted" IS NULL
+			ORDER BY "id" ASC`, deck)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var card Card
+			if err = scanCard(rows, &card); err != nil {
+				return err
+			}
+			cards = append(cards, card)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cards, nil
 }
 
 func cleanString(s string) string {
@@ -305,6 +876,21 @@ func cleanString(s string) string {
 	return s
 }
 
+// joinTags cleans and deduplicates tags, which are stored space separated.
+func joinTags(tags []string) string {
+	seen := make(map[string]bool)
+	var clean []string
+	for _, tag := range tags {
+		for _, t := range strings.Fields(cleanString(tag)) {
+			if !seen[t] {
+				seen[t] = true
+				clean = append(clean, t)
+			}
+		}
+	}
+	return strings.Join(clean, " ")
+}
+
 func comfortNorm(comfort float64) float64 {
 	return truncNorm(ComfortMin, ComfortMax, comfort, ComfortStddev)
 }
@@ -0,0 +1,169 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestDeck creates a deck of n cards without learning steps, so that cards
+// are only ordered by the scheduler.
+func newTestDeck(t *testing.T, tr *Trana, n int) int64 {
+	t.Helper()
+	ctx := context.Background()
+	deck, err := tr.CreateDeck(ctx, "Swedish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tr.SetLearningSteps(ctx, deck, []time.Duration{}, []time.Duration{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err = tr.CreateCard(ctx, deck, string(rune('a'+i)), string(rune('A'+i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return deck
+}
+
+func TestNextCardRepeatGap(t *testing.T) {
+	testcases := map[string]struct {
+		cards int
+		gap   int
+		delay time.Duration
+
+		// Cards to pick, 3 rounds of the deck if 0
+		picks int
+
+		// Picks since which a card may come again
+		want int
+	}{
+		"more cards than the gap":  {cards: 5, gap: 3, want: 3},
+		"as many cards as the gap": {cards: 3, gap: 3, want: 2},
+		"fewer cards than the gap": {cards: 2, gap: 3, want: 1},
+		"one card":                 {cards: 1, gap: 3, want: 0},
+		"delay":                    {cards: 4, delay: time.Hour, picks: 4, want: 3},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			tr := newTestTrana(t)
+			tr.repeatGap = tc.gap
+			tr.repeatDelay = tc.delay
+			deck := newTestDeck(t, tr, tc.cards)
+
+			// Forgotten cards stay first in order, so only the gap keeps
+			// them from coming again right away
+			picks := tc.picks
+			if picks == 0 {
+				picks = 3 * tc.cards
+			}
+			var picked []int64
+			for i := 0; i < picks; i++ {
+				card, err := tr.NextCard(ctx, deck)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for j := len(picked) - 1; j >= 0 && j >= len(picked)-tc.want; j-- {
+					if picked[j] == card.ID {
+						t.Fatalf("card %d again after %d picks %v; want at least %d between", card.ID, len(picked)-1-j, picked, tc.want)
+					}
+				}
+				picked = append(picked, card.ID)
+				if _, err = tr.ReviewCard(ctx, card.ID, ComfortReviewMin, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestUndoReviewUnburiesSiblings(t *testing.T) {
+	ctx := context.Background()
+	tr := newTestTrana(t)
+	tr.burySiblings = true
+
+	deck, err := tr.CreateDeck(ctx, "Swedish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, err := tr.CreateCard(ctx, deck, "hund", "dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sibling, err := tr.CreateCard(ctx, deck, "dog", "hund")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := tr.GetCard(ctx, card)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	review, err := tr.ReviewCard(ctx, card, ComfortReviewMax, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(review.Buried) != 1 || review.Buried[0] != sibling {
+		t.Fatalf("buried %v; want [%d]", review.Buried, sibling)
+	}
+	got, err := tr.GetCard(ctx, sibling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BuriedUntil == nil {
+		t.Fatal("sibling was not buried")
+	}
+
+	if err = tr.UndoReview(ctx, review, before); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = tr.GetCard(ctx, sibling); err != nil {
+		t.Fatal(err)
+	}
+	if got.BuriedUntil != nil {
+		t.Fatalf("sibling buried until %v after undo; want unburied", got.BuriedUntil)
+	}
+}
+
+func TestCardStateUnknownCard(t *testing.T) {
+	ctx := context.Background()
+	tr := newTestTrana(t)
+	deck := newTestDeck(t, tr, 2)
+	cards, err := tr.ListCards(ctx, deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed := cards[1].ID
+	if err = tr.DeleteCard(ctx, trashed); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]struct {
+		id   int64
+		want error
+	}{
+		"card":    {id: cards[0].ID},
+		"unknown": {id: trashed + 100, want: sql.ErrNoRows},
+		"trashed": {id: trashed, want: sql.ErrNoRows},
+	}
+	states := map[string]func(context.Context, int64) error{
+		"suspend":   tr.SuspendCard,
+		"unsuspend": tr.UnsuspendCard,
+		"bury":      tr.BuryCard,
+		"unbury":    tr.UnburyCard,
+	}
+
+	for name, tc := range testcases {
+		for state, set := range states {
+			t.Run(name+" "+state, func(t *testing.T) {
+				if err := set(ctx, tc.id); !errors.Is(err, tc.want) {
+					t.Fatalf("error %v; want %v", err, tc.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DefaultTrashRetention is how long deleted decks and cards are kept in the
+// trash if Options.TrashRetention is 0.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// liveCards is a condition on "cards" which leaves out cards in the trash and
+// cards of decks in the trash.
+const liveCards = `"cards"."deleted" IS NULL AND "cards"."deck" NOT IN (SELECT "id" FROM "decks" WHERE "deleted" IS NOT NULL)`
+
+// Trash lists the deleted decks and cards which have not been purged yet,
+// most recently deleted first.
+type Trash struct {
+	Decks []TrashDeck
+
+	// Cards of decks which are not in the trash
+	Cards []TrashCard
+}
+
+type TrashDeck struct {
+	Deck Deck
+
+	// Cards of the deck which were not deleted before it
+	Cards int
+
+	Deleted time.Time
+	Purged  time.Time
+}
+
+type TrashCard struct {
+	Card     Card
+	DeckName string
+
+	Deleted time.Time
+	Purged  time.Time
+}
+
+// ListTrash lists the decks and cards in the trash.
+func (t *Trana) ListTrash(ctx context.Context) (*Trash, error) {
+	var trash Trash
+	err := t.db.Tx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT ` + deckColumns + `, "deleted", (
+				SELECT COUNT(*) FROM "cards" WHERE "deck" = "decks"."id" AND "cards"."deleted" IS NULL
+			)
+			FROM "decks"
+			WHERE "deleted" IS NOT NULL
+			ORDER BY "deleted" DESC, "id" DESC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var deck TrashDeck
+			var deleted int64
+			if err = scanDeck(scanExtra{rows, []any{&deleted, &deck.Cards}}, &deck.Deck); err != nil {
+				return err
+			}
+			deck.Deleted = time.UnixMilli(deleted)
+			deck.Purged = deck.Deleted.Add(t.trashRetention)
+			trash.Decks = append(trash.Decks, deck)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(`SELECT "cards"."id", "cards"."uuid", "deck", "front", "back", "tags", "last_practiced", "comfort", "suspended", "buried_until", "learning_step", "learning_due", "relearning", "name", "cards"."deleted"
+			FROM "cards"
+			JOIN "decks" ON "decks"."id" = "cards"."deck"
+			WHERE "cards"."deleted" IS NOT NULL AND "decks"."deleted" IS NULL
+			ORDER BY "cards"."deleted" DESC, "cards"."id" DESC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var card TrashCard
+			var deleted int64
+			if err = scanCard(scanExtra{rows, []any{&card.DeckName, &deleted}}, &card.Card); err != nil {
+				return err
+			}
+			card.Deleted = time.UnixMilli(deleted)
+			card.Purged = card.Deleted.Add(t.trashRetention)
+			trash.Cards = append(trash.Cards, card)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &trash, nil
+}
+
+// RestoreDeck takes a deck out of the trash, with its cards which were not
+// deleted before it. It returns sql.ErrNoRows if the deck is not in the trash.
+func (t *Trana) RestoreDeck(ctx context.Context, id int64) error {
+	now := time.Now().UnixMilli()
+
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		if err := restoreTrash(tx, "deck", id, now); err != nil {
+			return err
+		}
+		// Send the cards again, in case a peer purged them with the deck
+		_, err := tx.Exec(`UPDATE "cards"
+			SET "changed" = @now
+			WHERE "deck" = @deck AND "deleted" IS NULL`, now, id)
+		return err
+	})
+}
+
+// RestoreCard takes a card out of the trash. It returns sql.ErrNoRows if the
+// card is not in the trash.
+func (t *Trana) RestoreCard(ctx context.Context, id int64) error {
+	now := time.Now().UnixMilli()
+
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		return restoreTrash(tx, "card", id, now)
+	})
+}
+
+// restoreTrash takes a deck or card, by kind and ID, out of the trash. Restoring
+// counts as an edit, so that it wins over the deletion when syncing.
+func restoreTrash(tx *sql.Tx, kind string, id int64, now int64) error {
+	table := `"decks"`
+	if kind == "card" {
+		table = `"cards"`
+	}
+	_, err := tx.Exec(`DELETE FROM "tombstones"
+		WHERE "uuid" = (SELECT "uuid" FROM `+table+` WHERE "id" = @id AND "deleted" IS NOT NULL)`, id)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`UPDATE `+table+`
+		SET "deleted" = NULL, "modified" = @now, "changed" = @now
+		WHERE "id" = @id AND "deleted" IS NOT NULL`, now, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeTrash permanently deletes the decks and cards which have been in the
+// trash for longer than Options.TrashRetention. It is also run by New.
+func (t *Trana) PurgeTrash(ctx context.Context) error {
+	return t.db.Tx(ctx, func(tx *sql.Tx) error {
+		return purgeTrash(tx, time.Now().Add(-t.trashRetention).UnixMilli())
+	})
+}
+
+// purgeTrash deletes the rows moved to the trash up to before, in Unix
+// milliseconds. The cards and reviews of purged decks are deleted with them.
+func purgeTrash(tx *sql.Tx, before int64) error {
+	for _, table := range []string{`"cards"`, `"decks"`} {
+		_, err := tx.Exec(`DELETE FROM `+table+`
+			WHERE "deleted" <= @before`, before)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package trana
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countRows counts the rows of a table, including those in the trash.
+func countRows(t *testing.T, tr *Trana, table string) int {
+	t.Helper()
+	var n int
+	err := tr.db.Tx(context.Background(), func(tx *sql.Tx) error {
+		return tx.QueryRow(`SELECT COUNT(*) FROM "` + table + `"`).Scan(&n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// trashedAgo moves the time a deck or card was deleted back by age.
+func trashedAgo(t *testing.T, tr *Trana, table string, id int64, age time.Duration) {
+	t.Helper()
+	err := tr.db.Tx(context.Background(), func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE "`+table+`"
+			SET "deleted" = "deleted" - @age
+			WHERE "id" = @id`, age.Milliseconds(), id)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	const day = 24 * time.Hour
+
+	testcases := map[string]struct {
+		retention time.Duration
+
+		// Age in the trash of a card, and of its deck if deck is set
+		age  time.Duration
+		deck bool
+
+		// Rows left after the purge
+		decks, cards, reviews int
+	}{
+		"card kept":              {retention: 7 * day, age: day, decks: 1, cards: 2, reviews: 2},
+		"card purged":            {retention: 7 * day, age: 8 * day, decks: 1, cards: 1, reviews: 1},
+		"deck kept":              {retention: 7 * day, age: day, deck: true, decks: 1, cards: 2, reviews: 2},
+		"deck purged":            {retention: 7 * day, age: 8 * day, deck: true},
+		"card kept by default":   {age: 29 * day, decks: 1, cards: 2, reviews: 2},
+		"card purged by default": {age: 31 * day, decks: 1, cards: 1, reviews: 1},
+		"deck purged by default": {age: 31 * day, deck: true},
+		"hour of retention":      {retention: time.Hour, age: 2 * time.Hour, decks: 1, cards: 1, reviews: 1},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			tr, err := New(":memory:", &Options{TrashRetention: tc.retention})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tr.Close()
+
+			deck := newTestDeck(t, tr, 2)
+			cards, err := tr.ListCards(ctx, deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, card := range cards {
+				if _, err = tr.ReviewCard(ctx, card.ID, ComfortReviewMax, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.deck {
+				if err = tr.DeleteDeck(ctx, deck); err != nil {
+					t.Fatal(err)
+				}
+				trashedAgo(t, tr, "decks", deck, tc.age)
+			} else {
+				if err = tr.DeleteCard(ctx, cards[0].ID); err != nil {
+					t.Fatal(err)
+				}
+				trashedAgo(t, tr, "cards", cards[0].ID, tc.age)
+			}
+
+			if err = tr.PurgeTrash(ctx); err != nil {
+				t.Fatal(err)
+			}
+			got := [3]int{countRows(t, tr, "decks"), countRows(t, tr, "cards"), countRows(t, tr, "reviews")}
+			if want := [3]int{tc.decks, tc.cards, tc.reviews}; got != want {
+				t.Fatalf("decks, cards and reviews left %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRestoreTrash(t *testing.T) {
+	testcases := map[string]struct {
+		// Deletes cards[0], then the deck, if set
+		deleteCard, deleteDeck bool
+
+		restore func(ctx context.Context, tr *Trana, deck int64, cards []Card) error
+		err     error
+
+		// Fronts of the live cards after restoring
+		fronts []string
+	}{
+		"card": {
+			deleteCard: true,
+			restore: func(ctx context.Context, tr *Trana, deck int64, cards []Card) error {
+				return tr.RestoreCard(ctx, cards[0].ID)
+			},
+			fronts: []string{"a", "b"},
+		},
+		"deck": {
+			deleteDeck: true,
+			restore: func(ctx context.Context, tr *Trana, deck int64, cards []Card) error {
+				return tr.RestoreDeck(ctx, deck)
+			},
+			fronts: []string{"a", "b"},
+		},
+		"deck without the card deleted before it": {
+			deleteCard: true,
+			deleteDeck: true,
+			restore: func(ctx context.Context, tr *Trana, deck int64, cards []Card) error {
+				return tr.RestoreDeck(ctx, deck)
+			},
+			fronts: []string{"b"},
+		},
+		"card of a deck in the trash": {
+			deleteDeck: true,
+			restore: func(ctx context.Context, tr *Trana, deck int64, cards []Card) error {
+				return tr.RestoreCard(ctx, cards[1].ID)
+			},
+			err: sql.ErrNoRows,
+		},
+		"card not in the trash": {
+			restore: func(ctx context.Context, tr *Trana, deck int64, cards []Card) error {
+				return tr.RestoreCard(ctx, cards[0].ID)
+			},
+			err:    sql.ErrNoRows,
+			fronts: []string{"a", "b"},
+		},
+		"deck not in the trash": {
+			restore: func(ctx context.Context, tr *Trana, deck int64, cards []Card) error {
+				return tr.RestoreDeck(ctx, deck)
+			},
+			err:    sql.ErrNoRows,
+			fronts: []string{"a", "b"},
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			tr := newTestTrana(t)
+			deck := newTestDeck(t, tr, 2)
+			cards, err := tr.ListCards(ctx, deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.deleteCard {
+				if err = tr.DeleteCard(ctx, cards[0].ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.deleteDeck {
+				if err = tr.DeleteDeck(ctx, deck); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err = tc.restore(ctx, tr, deck, cards); !errors.Is(err, tc.err) {
+				t.Fatalf("restore error %v; want %v", err, tc.err)
+			}
+			if tc.deleteDeck && tc.err != nil {
+				// The deck is still in the trash
+				return
+			}
+
+			live, err := tr.ListCards(ctx, deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fronts []string
+			for _, card := range live {
+				fronts = append(fronts, card.Front)
+			}
+			sort.Strings(fronts)
+			if strings.Join(fronts, ",") != strings.Join(tc.fronts, ",") {
+				t.Fatalf("cards %q; want %q", fronts, tc.fronts)
+			}
+		})
+	}
+}
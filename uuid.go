@@ -0,0 +1,100 @@
+package trana
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// nameUUID returns the version 5 UUID of name in the namespace UUID, which is
+// the same wherever it is computed.
+func nameUUID(namespace, name string) string {
+	var ns [16]byte
+	if _, err := hex.Decode(ns[:], []byte(strings.ReplaceAll(namespace, "-", ""))); err != nil {
+		panic(err)
+	}
+	h := sha1.New()
+	h.Write(ns[:])
+	h.Write([]byte(name))
+	var b [16]byte
+	copy(b[:], h.Sum(nil))
+	b[6] = b[6]&0x0f | 0x50
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// cleanUUID returns the canonical form of a UUID, or "" if s is not one.
+func cleanUUID(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !uuidPattern.MatchString(s) {
+		return ""
+	}
+	return s
+}
+
+// uuidUsedQuery reports whether the UUID is used in table.
+func uuidUsedQuery(table string) string {
+	return `SELECT EXISTS (SELECT 1 FROM "` + table + `" WHERE "uuid" = @uuid)`
+}
+
+// freeUUID returns the UUID if it is valid and not yet used, as reported by
+// the statement of uuidUsedQuery, otherwise a new UUID.
+func freeUUID(used *sql.Stmt, uuid string) (string, error) {
+	if uuid = cleanUUID(uuid); uuid == "" {
+		return newUUID(), nil
+	}
+	var exists bool
+	if err := used.QueryRow(uuid).Scan(&exists); err != nil {
+		return "", err
+	}
+	if exists {
+		return newUUID(), nil
+	}
+	return uuid, nil
+}
+
+// fillUUIDs gives UUIDs to rows created before UUIDs were added.
+func fillUUIDs(tx *sql.Tx) error {
+	for _, table := range []string{"decks", "cards"} {
+		rows, err := tx.Query(`SELECT "id" FROM "` + table + `" WHERE "uuid" IS NULL`)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if _, err = tx.Exec(`UPDATE "`+table+`" SET "uuid" = @uuid WHERE "id" = @id`, newUUID(), id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}